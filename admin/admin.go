@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ShutdownTimeout = 5 * time.Second
+)
+
+// Server is the operator HTTP API. Every request must carry the configured
+// token as a bearer credential.
+type Server struct {
+	Addr  string
+	Token string
+
+	mux *http.ServeMux
+}
+
+func (s *Server) HandleFunc(pattern string, h http.HandlerFunc) {
+	if s.mux == nil {
+		s.mux = http.NewServeMux()
+	}
+	s.mux.HandleFunc(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	log.Infof("ADMIN: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) Run(ctx context.Context, wg *sync.WaitGroup) {
+	if s.Addr == "" {
+		return
+	}
+	if s.Token == "" {
+		log.Warnf("No admin token configured, admin API will reject all requests")
+	}
+	if s.mux == nil {
+		s.mux = http.NewServeMux()
+	}
+	srv := &http.Server{
+		Addr:    s.Addr,
+		Handler: s,
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		log.Infof("Admin API listening on %s", s.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Errorf("Admin API failed: %v", err)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,17 +10,121 @@ import (
 	"github.com/jheidel/go-aprs"
 	log "github.com/sirupsen/logrus"
 
+	"jheidel-aprs/bulletin"
 	"jheidel-aprs/client"
+	"jheidel-aprs/emergency"
 	"jheidel-aprs/firebase"
+	"jheidel-aprs/geo"
+	"jheidel-aprs/observe"
+	"jheidel-aprs/policy"
+	"jheidel-aprs/relay"
+	"jheidel-aprs/reply"
+	"jheidel-aprs/telemetry"
 )
 
 type AprsHandler struct {
 	Client   client.ClientInterface
 	Outbox   *client.Outbox
 	Firebase *firebase.Firebase
+	Relay    *relay.Relay
+	Observer observe.Observer
+	Policy   *policy.Decider
+	Replies  *reply.Builder
+	// Telemetry decodes telemetry reports and definitions.
+	Telemetry *telemetry.Recorder
+}
+
+// aprsObservation normalizes an APRS packet for station activity subsystems.
+func aprsObservation(p *aprs.Packet) *observe.Observation {
+	o := &observe.Observation{
+		Source:   observe.SourceAprs,
+		Station:  p.Src.String(),
+		PacketID: firebase.AprsPacketID(p),
+		Time:     time.Now(),
+		Message:  p.Message,
+		Comment:  p.Comment,
+		ToCall:   p.Dst.String(),
+	}
+	if p.MessageTo != nil {
+		o.ToGateway = strings.EqualFold(p.MessageTo.String(), *serverCallsign)
+	}
+	if path := p.Path.String(); path != "" {
+		o.Path = strings.Split(path, ",")
+	}
+	if i := strings.Index(p.Raw, ":"); i != -1 && emergency.IsMicEEmergency(p.Dst.String(), p.Raw[i+1:]) {
+		o.Emergency = "Mic-E emergency"
+	}
+	if p.Position != nil {
+		o.Position = &geo.Point{
+			Lat: p.Position.Latitude,
+			Lon: p.Position.Longitude,
+		}
+	}
+	if p.Symbol[1] == '_' {
+		// Weather station symbol
+		o.Weather = p.Comment
+	}
+	if p.Altitude != 0 {
+		// APRS altitude is reported in feet.
+		o.HasAltitude = true
+		o.Altitude = p.Altitude * geo.FeetToMeters
+	}
+	return o
+}
+
+// reply sends a message back to the source of the packet. Progress is
+// recorded in firebase by reportReplies, and the final state once the
+// message is done.
+func (h *AprsHandler) reply(ctx context.Context, p *aprs.Packet, text, rule string) {
+	log.Infof("REPLY: %v", text)
+	m, err := h.Outbox.Send(p.Src, text, client.WithTrigger(firebase.AprsPacketID(p)), client.WithRule(rule))
+	if err != nil {
+		log.Warnf("Reply to %s not sent: %v", p.Src.String(), err)
+		return
+	}
+	go func() {
+		final := m.Wait()
+		log.Infof("Message done %v", spew.Sdump(final))
+		if err := h.Firebase.ReportAprsAck(ctx, final.Trigger, final.Result, final); err != nil {
+			log.Errorf("Failed to report message %s to firebase; %v", final.Result, err)
+		}
+	}()
+}
+
+// isReply returns whether the message was sent by reply, rather than e.g. a
+// notification about the triggering packet.
+func isReply(m *client.Message) bool {
+	return m.Rule == "relay" || strings.HasPrefix(m.Rule, "policy:")
+}
+
+// reportReplies records reply progress in firebase as it happens. Events
+// may be dropped by the subscription, so only progress is reported here,
+// and the final state by reply.
+func (h *AprsHandler) reportReplies(ctx context.Context) {
+	for ev := range h.Outbox.Subscribe(ctx) {
+		m := ev.Message
+		if m.Trigger == "" || !isReply(m) {
+			continue
+		}
+		if ev.Kind != client.EventQueued && ev.Kind != client.EventAttempted {
+			continue
+		}
+		if _, err := h.Outbox.Get(m.ID); err != nil {
+			continue // Already done, don't overwrite the final state.
+		}
+		if err := h.Firebase.ReportAprsAck(ctx, m.Trigger, ev.Kind, m); err != nil {
+			log.Errorf("Failed to report message %s to firebase; %v", ev.Kind, err)
+		}
+	}
 }
 
 func (h *AprsHandler) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.reportReplies(ctx)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -35,6 +139,14 @@ func (h *AprsHandler) Run(ctx context.Context, wg *sync.WaitGroup) {
 			log.Infof("MESSAGE: %v", p.Message)
 			log.Infof("POSITION: %v", p.Position.String())
 
+			if p.MessageTo != nil && client.IsBulletin(p.MessageTo.String()) {
+				log.Infof("BULLETIN from %s: %s", p.Src.String(), p.Message)
+				if err := bulletin.Report(ctx, h.Firebase, p); err != nil {
+					log.Errorf("Failed to report bulletin to firebase: %v", err)
+				}
+				continue
+			}
+
 			if err := h.Firebase.ReportAprsPacket(ctx, p); err != nil {
 				// This might be an error reporting, but there might also be another
 				// instance that reported first before we could.
@@ -42,24 +154,48 @@ func (h *AprsHandler) Run(ctx context.Context, wg *sync.WaitGroup) {
 				continue
 			}
 
-			if *respond {
-				now := time.Now()
-				text := fmt.Sprintf("RX %s", now.Format("3:04 PM"))
-
-				// TODO: generate reply message from firebase, maybe using pending
-				// messages?
-
-				log.Infof("REPLY: %v", text)
-				msg := h.Outbox.Send(p.Src, text)
-				go func(p *aprs.Packet) {
-					// Wait for acknowledgement or timeout.
-					msg.Wait()
-					log.Infof("Message done %v", spew.Sdump(msg))
-					if err := h.Firebase.ReportAprsAck(ctx, p, msg); err != nil {
-						log.Errorf("Failed to report message completion to firebase; %v", err)
-					}
-				}(p)
+			o := aprsObservation(p)
+			h.Observer.Observe(ctx, o)
+
+			h.Telemetry.Handle(ctx, p, o.PacketID)
+			if p.MessageTo != nil && p.MessageTo.String() == p.Src.String() {
+				continue // Addressed to itself, e.g. telemetry definitions.
+			}
+
+			// Relay confirmation, which replaces the usual reply.
+			var text, rule string
+			if p.MessageTo != nil && relay.IsCommand(p.Message) {
+				text = h.Relay.Handle(ctx, o.PacketID, p.Src.String(), p.Message)
+				rule = "relay"
+			}
+
+			if !*respond {
+				continue // Transmit kill switch.
+			}
+
+			if err := h.Outbox.Governor.CheckTrigger(p); err != nil {
+				continue // Logged by the governor.
+			}
+
+			now := time.Now()
+			ok, pol := h.Policy.Decide(ctx, p.Src.String(), p.MessageTo != nil, now)
+			if !ok {
+				log.Debugf("Reply policy for %s declines reply", p.Src.String())
+				continue
+			}
+
+			if text == "" {
+				var err error
+				kind := reply.Kind(o, p.MessageTo != nil)
+				rule = "policy:" + pol.Mode
+				text, err = h.Replies.Build(ctx, pol, o, kind)
+				if err != nil {
+					log.Errorf("Failed to build reply for %s: %v", p.Src.String(), err)
+					continue
+				}
 			}
+
+			h.reply(ctx, p, text, rule)
 		}
 	}()
 
@@ -0,0 +1,223 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Entry records a single transmitted packet. Each entry includes the hash of
+// the previous entry, so that any edit or removal breaks the chain.
+type Entry struct {
+	Time time.Time `json:"time" firestore:"time"`
+	// Line is the full packet line as written to the server.
+	Line   string `json:"line" firestore:"line"`
+	Server string `json:"server" firestore:"server"`
+	// Trigger identifies the packet which caused the transmission, if any.
+	Trigger string `json:"trigger,omitempty" firestore:"trigger"`
+	// Rule names the operator or rule responsible for the transmission.
+	Rule string `json:"rule,omitempty" firestore:"rule"`
+
+	PrevHash string `json:"prev_hash" firestore:"prev_hash"`
+	Hash     string `json:"hash" firestore:"hash"`
+}
+
+// digest computes the entry hash over every field but the hash itself.
+func (e *Entry) digest() string {
+	c := *e
+	c.Hash = ""
+	b, _ := json.Marshal(&c)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sink stores audit entries remotely in addition to the local file.
+type Sink interface {
+	StoreAudit(ctx context.Context, e *Entry) error
+}
+
+// Log is an append-only, hash-chained log of JSON lines.
+type Log struct {
+	Path string
+	Sink Sink
+
+	mu   sync.Mutex
+	f    *os.File
+	prev string
+}
+
+// completeLength returns the length of the file up to and including its
+// final newline.
+func completeLength(f *os.File) (int64, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 4096)
+	for end := st.Size(); end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		b := buf[:end-start]
+		if _, err := f.ReadAt(b, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(b, '\n'); i != -1 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// repair truncates an unterminated final line, left by a crash part way
+// through a write, moving it to a ".torn" file alongside the log. It
+// returns the length of the remaining log.
+func (l *Log) repair(f *os.File) (int64, error) {
+	n, err := completeLength(f)
+	if err != nil {
+		return 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if n == st.Size() {
+		return n, nil
+	}
+	torn := make([]byte, st.Size()-n)
+	if _, err := f.ReadAt(torn, n); err != nil {
+		return 0, err
+	}
+	qf, err := os.OpenFile(l.Path+".torn", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+	_, err = qf.Write(append(torn, '\n'))
+	if cerr := qf.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Truncate(l.Path, n); err != nil {
+		return 0, err
+	}
+	log.Errorf("AUDIT LOG %s: truncated torn final line of %d bytes, moved to %s.torn", l.Path, len(torn), l.Path)
+	return n, nil
+}
+
+// Open opens the log for appending, continuing the chain from the last entry.
+// The log and its directory are created if missing. A torn final line is
+// truncated, while any other damage is reported as tampering.
+func (l *Log) Open() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return err
+	}
+	if f, err := os.Open(l.Path); err == nil {
+		n, err := l.repair(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("repair audit log %s: %v", l.Path, err)
+		}
+		_, last, err := Verify(io.NewSectionReader(f, 0, n), nil)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("audit log %s has been tampered with: %v", l.Path, err)
+		}
+		if last != nil {
+			l.prev = last.Hash
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	l.f = f
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Record chains and appends an entry. The remote sink is written
+// asynchronously, as the local file is authoritative.
+func (l *Log) Record(ctx context.Context, e *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.PrevHash = l.prev
+	e.Hash = e.digest()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	l.prev = e.Hash
+
+	if l.Sink != nil {
+		go func() {
+			if err := l.Sink.StoreAudit(ctx, e); err != nil {
+				log.Errorf("Failed to store audit entry %s: %v", e.Hash, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// Verify reads a log, checking the hash chain, and calls fn for each entry
+// if not nil. It returns the number of entries and the last entry.
+func Verify(r io.Reader, fn func(*Entry)) (int, *Entry, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	var last *Entry
+	n := 0
+	for s.Scan() {
+		n++
+		e := &Entry{}
+		if err := json.Unmarshal(s.Bytes(), e); err != nil {
+			return n, last, fmt.Errorf("entry %d: %v", n, err)
+		}
+		prev := ""
+		if last != nil {
+			prev = last.Hash
+		}
+		if e.PrevHash != prev {
+			return n, last, fmt.Errorf("entry %d: chain broken, previous hash %s does not match %s", n, e.PrevHash, prev)
+		}
+		if h := e.digest(); e.Hash != h {
+			return n, last, fmt.Errorf("entry %d: hash %s does not match contents %s", n, e.Hash, h)
+		}
+		if fn != nil {
+			fn(e)
+		}
+		last = e
+	}
+	return n, last, s.Err()
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeLog(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	l := &Log{Path: path}
+	if err := l.Open(); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, line := range lines {
+		if err := l.Record(context.Background(), &Entry{Line: line}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func verifyFile(t *testing.T, path string) (int, error) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	n, _, err := Verify(f, nil)
+	return n, err
+}
+
+func TestOpenTruncatesTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeLog(t, path, "one", "two")
+
+	// Simulate a crash part way through writing a third entry.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2026-01-01T00:00:00Z","li`)
+	f.Close()
+
+	writeLog(t, path, "three")
+	if n, err := verifyFile(t, path); err != nil || n != 3 {
+		t.Errorf("Verify = %d, %v, want 3 entries", n, err)
+	}
+	torn, err := os.ReadFile(path + ".torn")
+	if err != nil {
+		t.Fatalf("torn line not quarantined: %v", err)
+	}
+	if !strings.HasPrefix(string(torn), `{"time"`) {
+		t.Errorf("quarantined %q, want the torn line", torn)
+	}
+}
+
+func TestOpenRejectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeLog(t, path, "one", "two")
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(b), "one", "uno", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Log{Path: path}
+	err = l.Open()
+	if err == nil || !strings.Contains(err.Error(), "tampered") {
+		t.Errorf("Open = %v, want tampering error", err)
+	}
+	if _, err := os.Stat(path + ".torn"); !os.IsNotExist(err) {
+		t.Errorf("complete lines were quarantined")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"jheidel-aprs/audit"
+)
+
+// addressee returns the addressee of a message packet line.
+func addressee(line string) string {
+	i := strings.Index(line, "::")
+	if i == -1 {
+		return ""
+	}
+	rest := line[i+2:]
+	if j := strings.Index(rest, ":"); j != -1 {
+		rest = rest[:j]
+	}
+	return strings.TrimSpace(rest)
+}
+
+// runAudit implements the audit subcommand, which verifies the local audit
+// log and prints matching entries as JSON lines.
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	file := fs.String("file", *auditLog, "Audit log file to read")
+	from := fs.String("from", "", "Start of the time range (RFC 3339 or YYYY-MM-DD), default all")
+	to := fs.String("to", "", "End of the time range (RFC 3339 or YYYY-MM-DD), default now")
+	station := fs.String("station", "", "Only entries addressed to this callsign")
+	fs.Parse(args)
+
+	start, err := parseTime(*from, time.Time{})
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(*to, time.Now())
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(os.Stdout)
+	n, _, err := audit.Verify(f, func(e *audit.Entry) {
+		if e.Time.Before(start) || e.Time.After(end) {
+			return
+		}
+		if *station != "" && addressee(e.Line) != *station {
+			return
+		}
+		enc.Encode(e)
+	})
+	if err != nil {
+		return fmt.Errorf("audit log verification failed: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Verified %d entries\n", n)
+	return nil
+}
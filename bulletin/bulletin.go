@@ -0,0 +1,113 @@
+package bulletin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/jheidel/go-aprs"
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/client"
+	"jheidel-aprs/firebase"
+)
+
+const (
+	CheckInterval = time.Minute
+
+	// DefaultInterval applies to bulletins without their own interval.
+	DefaultInterval = 30 * time.Minute
+)
+
+// addresseeRE matches general bulletins BLN0-9 and group bulletins BLNx
+// followed by a group name of up to five characters.
+var addresseeRE = regexp.MustCompile(`^BLN[0-9A-Z]([A-Z0-9]{1,5})?$`)
+
+// Validate checks that a bulletin can be transmitted.
+func Validate(b *firebase.Bulletin) error {
+	if !addresseeRE.MatchString(b.Addressee) {
+		return fmt.Errorf("invalid bulletin addressee %q", b.Addressee)
+	}
+	if b.Text == "" || len(b.Text) > client.MaxMessageLength {
+		return fmt.Errorf("bulletin text must be 1-%d characters", client.MaxMessageLength)
+	}
+	return nil
+}
+
+func interval(b *firebase.Bulletin) time.Duration {
+	if b.IntervalMinutes > 0 {
+		return time.Duration(b.IntervalMinutes * float64(time.Minute))
+	}
+	return DefaultInterval
+}
+
+// Scheduler transmits bulletins from firebase until they expire.
+type Scheduler struct {
+	Firebase *firebase.Firebase
+	Outbox   *client.Outbox
+}
+
+func (s *Scheduler) check(ctx context.Context) error {
+	bulletins, err := s.Firebase.LoadBulletins(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, b := range bulletins {
+		if !b.ExpiresAt.IsZero() && now.After(b.ExpiresAt) {
+			continue
+		}
+		if !b.LastSentAt.IsZero() && now.Sub(b.LastSentAt) < interval(b) {
+			continue
+		}
+		if err := Validate(b); err != nil {
+			log.Errorf("Skipping bulletin %s: %v", b.ID, err)
+			continue
+		}
+		log.Infof("BULLETIN %s: %s", b.Addressee, b.Text)
+		info := fmt.Sprintf(":%-9s:%s", b.Addressee, b.Text)
+		if err := s.Outbox.Broadcast(info, client.WithRule("bulletin:"+b.ID)); err != nil {
+			log.Warnf("Bulletin %s not sent: %v", b.ID, err)
+			continue
+		}
+		if err := s.Firebase.UpdateBulletinSent(ctx, b.ID, now); err != nil {
+			log.Errorf("Failed to record bulletin %s sent: %v", b.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(CheckInterval)
+		defer t.Stop()
+		for ctx.Err() == nil {
+			err := s.check(ctx)
+			if err != nil {
+				log.Errorf("Failed to check bulletins: %v", err)
+			}
+			s.Firebase.SetHealth("bulletins", err)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
+
+// Report stores a received bulletin.
+func Report(ctx context.Context, fb *firebase.Firebase, p *aprs.Packet) error {
+	now := time.Now()
+	return fb.ReportBulletin(ctx, &firebase.ReceivedBulletin{
+		Source:       p.Src.String(),
+		Addressee:    p.MessageTo.String(),
+		Text:         p.Message,
+		PacketID:     firebase.AprsPacketID(p),
+		FirstHeardAt: now,
+		LastHeardAt:  now,
+	})
+}
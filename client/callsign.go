@@ -0,0 +1,46 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jheidel/go-aprs"
+)
+
+// callsignRE matches an amateur radio callsign without SSID: a one or two
+// character prefix, a digit, and a suffix of up to four letters.
+var callsignRE = regexp.MustCompile(`^([A-Z]{1,2}|[0-9][A-Z]|[A-Z][0-9])[0-9][A-Z]{1,4}$`)
+
+// ValidateCallsign checks that s is a valid callsign with an optional SSID
+// in the range 1-15, as usable on RF.
+func ValidateCallsign(s string) error {
+	call, ssid := s, ""
+	if i := strings.Index(s, "-"); i != -1 {
+		call, ssid = s[:i], s[i+1:]
+	}
+	if !callsignRE.MatchString(call) {
+		return fmt.Errorf("invalid callsign %q", s)
+	}
+	if ssid != "" {
+		n, err := strconv.Atoi(ssid)
+		if err != nil || n < 1 || n > 15 || ssid[0] == '0' {
+			return fmt.Errorf("invalid SSID in %q, must be 1-15", s)
+		}
+	}
+	return nil
+}
+
+// CheckPasscode returns an error if the APRS-IS passcode does not belong to
+// the callsign.
+func CheckPasscode(callsign string, passcode int) error {
+	call, err := aprs.ParseAddress(callsign)
+	if err != nil {
+		return err
+	}
+	if int(call.Secret()) != passcode {
+		return fmt.Errorf("passcode does not match callsign %s", callsign)
+	}
+	return nil
+}
@@ -12,6 +12,8 @@ import (
 
 	"github.com/jheidel/go-aprs"
 	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/audit"
 )
 
 const (
@@ -26,12 +28,17 @@ const (
 )
 
 type Client struct {
-	Callsign      string
+	Callsign string
+	// Passcode is the APRS-IS passcode, -1 for receive only. Transmission
+	// is refused unless it matches Callsign.
+	Passcode      int
 	Filter        string
 	ServerAddress string
 	ServerPort    int
 	Outbox        *Outbox
 	BuildLabel    string
+	// Audit records every transmitted packet, if set.
+	Audit *audit.Log
 
 	reconnectDelay time.Duration
 	inbound        chan *aprs.Packet
@@ -71,12 +78,12 @@ func (c *Client) oneConnection(ctx context.Context) error {
 	clog.Infof("Connection established")
 
 	// Auth with server
-	call, err := aprs.ParseAddress(c.Callsign)
-	if err != nil {
-		return err
+	passErr := CheckPasscode(c.Callsign, c.Passcode)
+	if passErr != nil {
+		clog.Warnf("Connecting receive only: %v", passErr)
 	}
 	_, err = fmt.Fprintf(conn, "user %s pass %d vers %s %s filter %s\n",
-		c.Callsign, call.Secret(), ClientName, c.BuildLabel, c.Filter)
+		c.Callsign, c.Passcode, ClientName, c.BuildLabel, c.Filter)
 	if err != nil {
 		return err
 	}
@@ -140,19 +147,22 @@ func (c *Client) oneConnection(ctx context.Context) error {
 				clog.Debugf("Ignored our own packet")
 				continue
 			}
-			if p.MessageTo != nil && p.MessageTo.String() != c.Callsign {
+			c.Outbox.Heard(p.Src.String())
+			// Bulletins and messages a station addresses to itself, such as
+			// telemetry definitions, are passed along too.
+			if to := p.MessageTo; to != nil && to.String() != c.Callsign && !IsBulletin(to.String()) && to.String() != p.Src.String() {
 				clog.Debugf("Message to %q is not intended for us, dropped", p.MessageTo.String())
 				continue
 			}
 
-			if p.IsAck() {
-				an, err := p.AckNumber()
-				if err != nil {
-					clog.Errorf("Failed to get ack: %v", err)
-					continue
-				}
-				clog.Debugf("Ack packet for message #%d", an)
-				c.Outbox.Ack(an)
+			if id, ok := responseID(&p, "ack"); ok {
+				clog.Debugf("Ack packet for message #%s", id)
+				c.Outbox.Ack(p.Src.String(), id)
+				continue
+			}
+			if id, ok := responseID(&p, "rej"); ok {
+				clog.Debugf("Rej packet for message #%s", id)
+				c.Outbox.Reject(p.Src.String(), id)
 				continue
 			}
 
@@ -160,9 +170,31 @@ func (c *Client) oneConnection(ctx context.Context) error {
 			c.inbound <- &p
 
 		case msg := <-c.Outbox.Outbound():
-			line := fmt.Sprintf("%s>APRS,WIDE::%s : %s{%d\n", c.Callsign, msg.Addr.String(), msg.Message, msg.ID)
+			if passErr != nil {
+				clog.Errorf("Refusing to transmit: %v", passErr)
+				continue
+			}
+			var line string
+			if msg.Addr == nil {
+				line = fmt.Sprintf("%s>APRS,TCPIP*:%s\n", c.Callsign, msg.Message)
+			} else {
+				line = fmt.Sprintf("%s>APRS,WIDE::%s : %s{%s\n", c.Callsign, msg.Addr.String(), msg.Message, msg.ID)
+			}
 
 			clog.Debugf("SEND: %v", strings.TrimSpace(line))
+			if c.Audit != nil {
+				err := c.Audit.Record(ctx, &audit.Entry{
+					Line:    strings.TrimSpace(line),
+					Server:  conn.RemoteAddr().String(),
+					Trigger: msg.Trigger,
+					Rule:    msg.Rule,
+				})
+				if err != nil {
+					// Never transmit without a record.
+					clog.Errorf("Audit failed, packet not sent: %v", err)
+					continue
+				}
+			}
 			if _, err := conn.Write([]byte(line)); err != nil {
 				return fmt.Errorf("packet write: %v", err)
 			}
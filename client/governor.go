@@ -0,0 +1,252 @@
+package client
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jheidel/go-aprs"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// Token bucket shared by replies, retries and operator messages.
+	GovernorBurst    = 6
+	GovernorInterval = 15 * time.Second
+
+	// Separate token bucket for broadcasts, e.g. bulletins, objects and
+	// telemetry, so that they can't starve replies.
+	BroadcastBurst    = 6
+	BroadcastInterval = time.Minute
+
+	// New messages to a single destination within DestinationWindow.
+	DestinationLimit  = 4
+	DestinationWindow = 10 * time.Minute
+
+	// Identical messages to a destination within LoopWindow before the
+	// exchange is considered a loop.
+	LoopRepeats = 3
+	LoopWindow  = 30 * time.Minute
+)
+
+var (
+	ErrGlobalRate      = errors.New("global transmit rate exceeded")
+	ErrBroadcastRate   = errors.New("broadcast rate exceeded")
+	ErrDestinationRate = errors.New("destination transmit rate exceeded")
+	ErrLoop            = errors.New("message loop detected")
+	ErrAutomated       = errors.New("triggered by an automated station")
+
+	// governorBlocked counts blocked transmissions by reason.
+	governorBlocked = expvar.NewMap("governor_blocked")
+)
+
+// automatedToCalls are TOCALL prefixes of gateway and auto-responder
+// software, which we must not reply to.
+var automatedToCalls = []string{
+	"APBPQ", // BPQ32 node
+	"APJI",  // jAPRSIgate
+	"APMG",  // MiniGate
+	"APRX",  // aprx igate/digi
+	"APLRG", // LoRa igate
+	"APWEE", // WeeWX weather station
+}
+
+// bucket is a token bucket, which starts full.
+type bucket struct {
+	burst    float64
+	interval time.Duration
+
+	tokens float64
+	filled time.Time
+}
+
+// take consumes a token, if one is available.
+func (b *bucket) take(now time.Time) bool {
+	if b.filled.IsZero() {
+		b.tokens = b.burst
+	} else {
+		b.tokens += float64(now.Sub(b.filled)) / float64(b.interval)
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.filled = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens -= 1
+	return true
+}
+
+// Governor limits transmissions to keep the gateway within RF etiquette,
+// whatever the filter or the stations it hears do.
+type Governor struct {
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	replies    *bucket
+	broadcasts *bucket
+
+	// sends records new message times by destination.
+	sends map[string][]time.Time
+	// texts records new message times by destination and text.
+	texts map[string][]time.Time
+	// echoes records new message times by text alone.
+	echoes map[string][]time.Time
+	swept  time.Time
+}
+
+// init prepares the governor and returns the current time. It must be
+// called with the lock held.
+func (g *Governor) init() time.Time {
+	if g.replies == nil {
+		g.replies = &bucket{burst: GovernorBurst, interval: GovernorInterval}
+		g.broadcasts = &bucket{burst: BroadcastBurst, interval: BroadcastInterval}
+		g.sends = make(map[string][]time.Time)
+		g.texts = make(map[string][]time.Time)
+		g.echoes = make(map[string][]time.Time)
+	}
+	if g.Now != nil {
+		return g.Now()
+	}
+	return time.Now()
+}
+
+func (g *Governor) block(err error, format string, args ...interface{}) error {
+	governorBlocked.Add(err.Error(), 1)
+	log.Warnf("GOVERNOR blocked %s: %v", fmt.Sprintf(format, args...), err)
+	return err
+}
+
+// prune drops times older than the window and returns the remainder.
+func prune(ts []time.Time, now time.Time, window time.Duration) []time.Time {
+	var out []time.Time
+	for _, t := range ts {
+		if now.Sub(t) < window {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// recent prunes the times stored under the key, deleting the key once none
+// remain, and returns the remainder.
+func recent(m map[string][]time.Time, key string, now time.Time, window time.Duration) []time.Time {
+	ts := prune(m[key], now, window)
+	if len(ts) == 0 {
+		delete(m, key)
+	} else {
+		m[key] = ts
+	}
+	return ts
+}
+
+// sweep prunes every key at most once per LoopWindow, so that destinations
+// and texts which never recur don't accumulate.
+func (g *Governor) sweep(now time.Time) {
+	if now.Sub(g.swept) < LoopWindow {
+		return
+	}
+	g.swept = now
+	for key := range g.sends {
+		recent(g.sends, key, now, DestinationWindow)
+	}
+	for key := range g.texts {
+		recent(g.texts, key, now, LoopWindow)
+	}
+	for key := range g.echoes {
+		recent(g.echoes, key, now, LoopWindow)
+	}
+}
+
+// Admit checks whether a new message may be sent, recording it if so.
+func (g *Governor) Admit(dst, text string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.init()
+	g.sweep(now)
+
+	sends := recent(g.sends, dst, now, DestinationWindow)
+	if len(sends) >= DestinationLimit {
+		return g.block(ErrDestinationRate, "message to %s", dst)
+	}
+	key := dst + ":" + text
+	texts := recent(g.texts, key, now, LoopWindow)
+	if len(texts) >= LoopRepeats {
+		return g.block(ErrLoop, "message to %s %q", dst, text)
+	}
+	if !g.replies.take(now) {
+		return g.block(ErrGlobalRate, "message to %s", dst)
+	}
+
+	g.sends[dst] = append(sends, now)
+	g.texts[key] = append(texts, now)
+	g.echoes[text] = append(recent(g.echoes, text, now, LoopWindow), now)
+	return nil
+}
+
+// AdmitOperator checks whether a notification to an operator may be sent.
+// Only the global rate applies, as operators expect repeated alerts.
+func (g *Governor) AdmitOperator(dst, text string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.replies.take(g.init()) {
+		return g.block(ErrGlobalRate, "operator message to %s", dst)
+	}
+	return nil
+}
+
+// AllowAttempt checks whether a retransmission may be sent now.
+func (g *Governor) AllowAttempt(dst string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.replies.take(g.init()) {
+		g.block(ErrGlobalRate, "retry to %s", dst)
+		return false
+	}
+	return true
+}
+
+// AllowBroadcast checks whether a broadcast packet may be sent now.
+func (g *Governor) AllowBroadcast() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.broadcasts.take(g.init()) {
+		g.block(ErrBroadcastRate, "broadcast")
+		return false
+	}
+	return true
+}
+
+// CheckTrigger returns an error if the gateway must not reply to the packet,
+// because it came from automated software or echoes our own transmissions.
+// A nil Governor allows every packet.
+func (g *Governor) CheckTrigger(p *aprs.Packet) error {
+	if g == nil {
+		return nil
+	}
+	src := p.Src.String()
+	tocall := strings.ToUpper(p.Dst.String())
+	for _, prefix := range automatedToCalls {
+		if strings.HasPrefix(tocall, prefix) {
+			return g.block(ErrAutomated, "reply to %s (tocall %s)", src, tocall)
+		}
+	}
+	if p.Message == "" {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.init()
+	// A station sending us back text we recently sent is likely an
+	// auto-responder, and replying would ping-pong forever.
+	if len(recent(g.echoes, p.Message, now, LoopWindow)) > 0 {
+		return g.block(ErrLoop, "reply to %s echoing %q", src, p.Message)
+	}
+	return nil
+}
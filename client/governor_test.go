@@ -0,0 +1,185 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jheidel/go-aprs"
+)
+
+// clock is a settable time source for the governor.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestGovernor() (*Governor, *clock) {
+	c := &clock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	return &Governor{Now: c.Now}, c
+}
+
+func TestGovernorBucketRefill(t *testing.T) {
+	g, c := newTestGovernor()
+	for i := 0; i < GovernorBurst; i++ {
+		if !g.AllowAttempt("K1ABC") {
+			t.Fatalf("AllowAttempt #%d blocked with a full bucket", i+1)
+		}
+	}
+	if g.AllowAttempt("K1ABC") {
+		t.Fatalf("AllowAttempt allowed with an empty bucket")
+	}
+	c.Advance(GovernorInterval / 2)
+	if g.AllowAttempt("K1ABC") {
+		t.Errorf("AllowAttempt allowed before a token refilled")
+	}
+	c.Advance(GovernorInterval / 2)
+	if !g.AllowAttempt("K1ABC") {
+		t.Errorf("AllowAttempt blocked after a token refilled")
+	}
+	if g.AllowAttempt("K1ABC") {
+		t.Errorf("AllowAttempt allowed more than the refilled token")
+	}
+}
+
+func TestGovernorBroadcastBudget(t *testing.T) {
+	g, _ := newTestGovernor()
+	for i := 0; i < BroadcastBurst; i++ {
+		if !g.AllowBroadcast() {
+			t.Fatalf("AllowBroadcast #%d blocked with a full bucket", i+1)
+		}
+	}
+	if g.AllowBroadcast() {
+		t.Errorf("AllowBroadcast allowed with an empty bucket")
+	}
+	// Broadcasts must not starve replies.
+	if err := g.Admit("K1ABC", "RX 12:00 PM"); err != nil {
+		t.Errorf("Admit after broadcasts = %v, want nil", err)
+	}
+}
+
+func TestGovernorDestinationLimit(t *testing.T) {
+	g, c := newTestGovernor()
+	for i := 0; i < DestinationLimit; i++ {
+		c.Advance(GovernorInterval)
+		if err := g.Admit("K1ABC", string(rune('a'+i))); err != nil {
+			t.Fatalf("Admit #%d: %v", i+1, err)
+		}
+	}
+	if err := g.Admit("K1ABC", "more"); !errors.Is(err, ErrDestinationRate) {
+		t.Errorf("Admit over limit = %v, want %v", err, ErrDestinationRate)
+	}
+	if err := g.Admit("W1XYZ", "more"); err != nil {
+		t.Errorf("Admit to another destination = %v, want nil", err)
+	}
+	c.Advance(DestinationWindow)
+	if err := g.Admit("K1ABC", "more"); err != nil {
+		t.Errorf("Admit after window = %v, want nil", err)
+	}
+}
+
+func TestGovernorLoop(t *testing.T) {
+	g, c := newTestGovernor()
+	for i := 0; i < LoopRepeats; i++ {
+		c.Advance(GovernorInterval)
+		if err := g.Admit("K1ABC", "RX"); err != nil {
+			t.Fatalf("Admit #%d: %v", i+1, err)
+		}
+	}
+	c.Advance(GovernorInterval)
+	if err := g.Admit("K1ABC", "RX"); !errors.Is(err, ErrLoop) {
+		t.Errorf("Admit repeated text = %v, want %v", err, ErrLoop)
+	}
+	c.Advance(LoopWindow)
+	if err := g.Admit("K1ABC", "RX"); err != nil {
+		t.Errorf("Admit after loop window = %v, want nil", err)
+	}
+}
+
+func TestGovernorOperatorExempt(t *testing.T) {
+	g, c := newTestGovernor()
+	text := "EMERGENCY N0CALL-9 unacked: keyword \"SOS\""
+	for i := 0; i < LoopRepeats; i++ {
+		if err := g.Admit("K1ABC", text); err != nil {
+			t.Fatalf("Admit #%d: %v", i+1, err)
+		}
+	}
+	if err := g.Admit("K1ABC", text); !errors.Is(err, ErrLoop) {
+		t.Errorf("Admit repeated text = %v, want %v", err, ErrLoop)
+	}
+	c.Advance(GovernorBurst * GovernorInterval) // Refill the bucket.
+	for i := 0; i < DestinationLimit+1; i++ {
+		if err := g.AdmitOperator("K1ABC", text); err != nil {
+			t.Fatalf("AdmitOperator #%d: %v", i+1, err)
+		}
+	}
+}
+
+func testPacket(t *testing.T, src, dst, message string) *aprs.Packet {
+	t.Helper()
+	s, err := aprs.ParseAddress(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := aprs.ParseAddress(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &aprs.Packet{Src: s, Dst: d, Message: message}
+}
+
+func TestGovernorCheckTrigger(t *testing.T) {
+	g, c := newTestGovernor()
+	if err := g.Admit("K1ABC", "RX 12:00 PM"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		dst     string
+		message string
+		want    error
+	}{
+		{"person", "APDR16", "hello", nil},
+		{"aprx", "APRX29", "hello", ErrAutomated},
+		{"weewx beacon", "APWEE5", "", ErrAutomated},
+		{"echo", "APDR16", "RX 12:00 PM", ErrLoop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := g.CheckTrigger(testPacket(t, "W1XYZ", tt.dst, tt.message)); !errors.Is(err, tt.want) {
+				t.Errorf("CheckTrigger = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	c.Advance(LoopWindow)
+	if err := g.CheckTrigger(testPacket(t, "W1XYZ", "APDR16", "RX 12:00 PM")); err != nil {
+		t.Errorf("CheckTrigger after loop window = %v, want nil", err)
+	}
+	if len(g.echoes) != 0 {
+		t.Errorf("echoes holds %d expired texts, want none", len(g.echoes))
+	}
+}
+
+func TestGovernorSweep(t *testing.T) {
+	g, c := newTestGovernor()
+	for _, dst := range []string{"K1ABC", "W1XYZ", "N0CALL"} {
+		if err := g.Admit(dst, "hello "+dst); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Advance(LoopWindow)
+	if err := g.Admit("K1ABC", "again"); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.sends) != 1 || len(g.texts) != 1 || len(g.echoes) != 1 {
+		t.Errorf("after sweep sends=%d texts=%d echoes=%d, want 1 each", len(g.sends), len(g.texts), len(g.echoes))
+	}
+}
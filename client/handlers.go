@@ -0,0 +1,60 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (m *Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	addr := ""
+	if m.Addr != nil {
+		addr = m.Addr.String()
+	}
+	return json.Marshal(&struct {
+		Addr string
+		*message
+	}{addr, (*message)(m)})
+}
+
+// HandleList is the admin API handler for GET /outbox.
+func (o *Outbox) HandleList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o.List())
+}
+
+// HandleGet is the admin API handler for GET /outbox/{id}.
+func (o *Outbox) HandleGet(w http.ResponseWriter, r *http.Request) {
+	msg, err := o.Get(r.PathValue("id"))
+	if err == ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(msg)
+}
+
+// HandleCancel is the admin API handler for DELETE /outbox/{id}.
+func (o *Outbox) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	if err := o.Cancel(r.PathValue("id")); err == ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleEvents is the admin API handler for GET /outbox/events, which
+// streams message events as JSON lines until the client disconnects.
+func (o *Outbox) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for ev := range o.Subscribe(r.Context()) {
+		if err := enc.Encode(ev); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Identifier periodically transmits a station identification status.
+type Identifier struct {
+	Outbox   *Outbox
+	Text     string
+	Interval time.Duration
+}
+
+func (i *Identifier) Run(ctx context.Context, wg *sync.WaitGroup) {
+	if i.Interval <= 0 {
+		log.Infof("Station identification disabled")
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(i.Interval)
+		defer t.Stop()
+		for ctx.Err() == nil {
+			log.Infof("STATION ID: %s", i.Text)
+			if err := i.Outbox.Broadcast(">"+i.Text, WithRule("station-id")); err != nil {
+				log.Warnf("Station ID not sent: %v", err)
+			}
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
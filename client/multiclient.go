@@ -12,19 +12,34 @@ import (
 
 const (
 	DedupHistory = time.Hour
+
+	// ReackInterval suppresses acks to copies of a message received over
+	// several connections at once.
+	ReackInterval = 10 * time.Second
 )
 
+// inboundMessage tracks a message received from a station.
+type inboundMessage struct {
+	receivedAt time.Time
+	ackedAt    time.Time
+}
+
 // MultiClient implements a redundant connection to multiple clients.
 type MultiClient struct {
 	Clients []ClientInterface
+	// Outbox sends acks to inbound messages, if set.
+	Outbox *Outbox
 
 	inbound chan *aprs.Packet
 	history map[string]time.Time
+	// messages tracks inbound messages by source and message ID.
+	messages map[string]*inboundMessage
 }
 
 func (c *MultiClient) init() {
 	c.inbound = make(chan *aprs.Packet)
 	c.history = make(map[string]time.Time)
+	c.messages = make(map[string]*inboundMessage)
 }
 
 func (c *MultiClient) cleanup() {
@@ -46,6 +61,34 @@ func (c *MultiClient) isDuplicate(p *aprs.Packet) bool {
 	return ok
 }
 
+// isRetransmission tracks a message with an ID, returning whether it was
+// already received. Retransmissions are re-acked, since our earlier ack was
+// evidently lost. Bulletins are never acked.
+func (c *MultiClient) isRetransmission(ctx context.Context, p *aprs.Packet, id string) bool {
+	for key, m := range c.messages {
+		if time.Since(m.receivedAt) > DedupHistory {
+			delete(c.messages, key)
+		}
+	}
+
+	key := p.Src.String() + ":" + id
+	m, ok := c.messages[key]
+	if !ok {
+		m = &inboundMessage{receivedAt: time.Now()}
+		c.messages[key] = m
+	}
+	bulletin := p.MessageTo != nil && IsBulletin(p.MessageTo.String())
+	if c.Outbox != nil && !bulletin && time.Since(m.ackedAt) > ReackInterval {
+		m.ackedAt = time.Now()
+		go func() {
+			if err := c.Outbox.SendAck(ctx, p.Src, id); err != nil {
+				log.Warnf("Failed to ack message %s from %s: %v", id, p.Src.String(), err)
+			}
+		}()
+	}
+	return ok
+}
+
 func (c *MultiClient) Run(ctx context.Context, wg *sync.WaitGroup) {
 	c.init()
 
@@ -79,7 +122,16 @@ func (c *MultiClient) Run(ctx context.Context, wg *sync.WaitGroup) {
 				cwg.Wait()
 				return
 			case p := <-recvc:
-				if !c.isDuplicate(p) {
+				if id := messageID(p); id != "" {
+					// Messages with an ID are tracked by sender and ID rather
+					// than hash, so that retransmissions are caught whatever
+					// their path and repeated text with a new ID is not.
+					if !c.isRetransmission(ctx, p, id) {
+						c.inbound <- p
+					} else {
+						log.Debugf("Dropped retransmission of message %s from %s", id, p.Src.String())
+					}
+				} else if !c.isDuplicate(p) {
 					c.inbound <- p
 				} else {
 					log.Debugf("Dropped duplicate packet")
@@ -93,6 +145,17 @@ func (c *MultiClient) Receive() <-chan *aprs.Packet {
 	return c.inbound
 }
 
+// Connected returns the number of healthy connections.
+func (c *MultiClient) Connected() int {
+	n := 0
+	for _, sc := range c.Clients {
+		if sc.Status() == nil {
+			n++
+		}
+	}
+	return n
+}
+
 func (c *MultiClient) Status() error {
 	var err error
 	for _, sc := range c.Clients {
@@ -2,6 +2,11 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,13 +15,31 @@ import (
 )
 
 const (
-	IDResetInterval = 48 * time.Hour
+	// MaxIDLength is the longest message ID allowed by APRS 1.1.
+	MaxIDLength = 5
+	// IDPrefixLength is the length of the random instance prefix used when
+	// no IDPrefix is configured.
+	IDPrefixLength = 2
 
+	// Defaults for the retry policies.
 	AttemptInterval = 30 * time.Second
 	MaxAttempts     = 5
+
+	// SubscriberBuffer is the number of events buffered for each
+	// subscriber; slower subscribers miss events.
+	SubscriberBuffer = 64
 )
 
+var ErrNotFound = errors.New("message not found")
+
+const idChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Message is an outgoing message. Addr, Message, ID, Trigger, Rule and Policy
+// are fixed once sent; the delivery state is owned by the Outbox and must be
+// read from a snapshot, as returned by Wait, Get, List or an Event.
 type Message struct {
+	// Addr is nil for broadcast packets, which carry Message as the raw
+	// information field and are not acknowledged.
 	Addr          *aprs.Address
 	Message       string
 	SentAt        time.Time
@@ -24,40 +47,226 @@ type Message struct {
 	NextAttemptAt time.Time
 	ReceivedAt    time.Time
 	Received      bool
-	ID            int
+	ID            string
 	Attempts      int
+	// Result is the final event kind once the message is done.
+	Result EventKind
+
+	// Policy schedules retries, and Schedule holds the time of each
+	// attempt, which may be postponed by the governor.
+	Policy   *RetryPolicy
+	Schedule []time.Time
+
+	// Trigger identifies the packet which caused the message, and Rule the
+	// operator or rule responsible, for the audit log.
+	Trigger string
+	Rule    string
+	// Operator marks a notification to a gateway operator, rather than an
+	// automatic reply.
+	Operator bool
+
+	done  chan struct{}
+	final *Message
+}
+
+// SendOption configures a message queued with Send.
+type SendOption func(*Message)
 
-	donec chan bool
+// WithTrigger records the ID of the packet which caused the message.
+func WithTrigger(packetID string) SendOption {
+	return func(m *Message) {
+		m.Trigger = packetID
+	}
+}
+
+// WithRule records the operator or rule responsible for the message.
+func WithRule(rule string) SendOption {
+	return func(m *Message) {
+		m.Rule = rule
+	}
 }
 
-func (m *Message) Wait() {
-	<-m.donec
+// ToOperator marks a notification to a gateway operator. These are exempt
+// from the destination and loop limits on automatic replies, so that
+// repeated alerts are not blocked.
+func ToOperator() SendOption {
+	return func(m *Message) {
+		m.Operator = true
+	}
+}
+
+func (m *Message) snapshot() *Message {
+	s := *m
+	s.Schedule = append([]time.Time(nil), m.Schedule...)
+	return &s
+}
+
+// Wait blocks until the message is acknowledged, rejected, expired or
+// cancelled, returning its final state.
+func (m *Message) Wait() *Message {
+	<-m.done
+	return m.final
+}
+
+type EventKind string
+
+const (
+	EventQueued    EventKind = "queued"
+	EventAttempted EventKind = "attempted"
+	EventAcked     EventKind = "acked"
+	EventRejected  EventKind = "rejected"
+	EventExpired   EventKind = "expired"
+	EventCancelled EventKind = "cancelled"
+)
+
+// Event reports a change in the delivery state of a message.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+	// Message is a snapshot as of the event.
+	Message *Message
 }
 
 type Outbox struct {
-	outbox map[int]*Message
-	idGen  int
+	// Governor limits transmissions, if set.
+	Governor *Governor
+
+	// RetryPolicy applies to messages sent without their own, default
+	// DefaultRetryPolicy.
+	RetryPolicy *RetryPolicy
+
+	// IDPrefix starts every message ID, so that redundant gateway
+	// instances do not send overlapping IDs. Random if empty.
+	IDPrefix string
+
+	// mu guards the outbox and the delivery state of its messages. pending
+	// counts outstanding messages by addressee, and heard tracks when each
+	// station was last heard, as far back as the longest HeardWithin of any
+	// retry policy used.
+	mu          sync.Mutex
+	outbox      map[string]*Message
+	idSeq       int
+	pending     map[string]int
+	heard       map[string]time.Time
+	heardWithin time.Duration
+	heardPruned time.Time
+	subs        []chan Event
 
-	ackc        chan int
 	sendc, outc chan *Message
 }
 
-func (o *Outbox) attemptMessage(msg *Message) {
-	msg.LastSentAt = time.Now()
-	msg.NextAttemptAt = msg.LastSentAt.Add(AttemptInterval)
-	if msg.Attempts >= MaxAttempts {
-		msg.donec <- true
-		close(msg.donec)
-		msg.NextAttemptAt = time.Time{}
-		log.Warnf("Exceeded retry count for message ID#%d, discarding", msg.ID)
-		delete(o.outbox, msg.ID)
-		return
+// publish sends an event to subscribers. Must hold mu.
+func (o *Outbox) publish(kind EventKind, msg *Message) {
+	ev := Event{
+		Kind:    kind,
+		Time:    time.Now(),
+		Message: msg.snapshot(),
 	}
+	for _, c := range o.subs {
+		select {
+		case c <- ev:
+		default:
+			log.Debugf("Dropped %s event for message ID#%s, subscriber is behind", kind, msg.ID)
+		}
+	}
+}
+
+// finish completes a message. Must hold mu.
+func (o *Outbox) finish(msg *Message, kind EventKind) {
+	msg.NextAttemptAt = time.Time{}
+	msg.Result = kind
+	o.remove(msg)
+	o.publish(kind, msg)
+	msg.final = msg.snapshot()
+	close(msg.done)
+}
+
+// attemptMessage advances the message state, returning whether the message
+// should be transmitted. Must hold mu.
+func (o *Outbox) attemptMessage(msg *Message) bool {
+	now := time.Now()
+	if msg.Attempts >= len(msg.Schedule) {
+		log.Warnf("Exceeded retry count for message ID#%s, discarding", msg.ID)
+		o.finish(msg, EventExpired)
+		return false
+	}
+	if msg.Attempts > 0 {
+		call := msg.Addr.String()
+		if h := msg.Policy.HeardWithin; h > 0 && now.Sub(o.heard[call]) > h {
+			log.Warnf("Recipient not heard recently for message ID#%s, discarding", msg.ID)
+			o.finish(msg, EventExpired)
+			return false
+		}
+		if o.Governor != nil && !o.Governor.AllowAttempt(call) {
+			// Postpone the remaining schedule without counting the attempt.
+			for i := msg.Attempts; i < len(msg.Schedule); i++ {
+				msg.Schedule[i] = msg.Schedule[i].Add(GovernorInterval)
+			}
+			msg.NextAttemptAt = msg.Schedule[msg.Attempts]
+			return false
+		}
+	}
+	msg.LastSentAt = now
 	msg.Attempts += 1
-	log.Infof("Sending message ID#%d (attempt %d)", msg.ID, msg.Attempts)
-	o.outc <- msg
+	if msg.Attempts < len(msg.Schedule) {
+		msg.NextAttemptAt = msg.Schedule[msg.Attempts]
+	} else {
+		// Allow the last attempt as long as the one before to be acked.
+		wait := msg.Policy.Interval
+		if n := len(msg.Schedule); n > 1 {
+			wait = msg.Schedule[n-1].Sub(msg.Schedule[n-2])
+		}
+		msg.NextAttemptAt = now.Add(wait)
+	}
+	log.Infof("Sending message ID#%s (attempt %d)", msg.ID, msg.Attempts)
+	o.publish(EventAttempted, msg)
+	return true
+}
+
+// Must hold mu.
+func (o *Outbox) add(msg *Message) {
+	o.outbox[msg.ID] = msg
+	o.pending[msg.Addr.String()] += 1
+}
+
+// Must hold mu.
+func (o *Outbox) remove(msg *Message) {
+	delete(o.outbox, msg.ID)
+	call := msg.Addr.String()
+	if o.pending[call] -= 1; o.pending[call] <= 0 {
+		delete(o.pending, call)
+	}
 }
 
+// Heard records that a packet was received from the callsign.
+func (o *Outbox) Heard(callsign string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.heard[callsign] = time.Now()
+}
+
+// pruneHeard forgets stations heard too long ago for any retry policy to
+// accept, at most once a minute. Must hold mu.
+func (o *Outbox) pruneHeard(now time.Time) {
+	if now.Sub(o.heardPruned) < time.Minute {
+		return
+	}
+	o.heardPruned = now
+	for call, t := range o.heard {
+		if now.Sub(t) > o.heardWithin {
+			delete(o.heard, call)
+		}
+	}
+}
+
+// Pending returns the number of unacknowledged messages to the callsign.
+func (o *Outbox) Pending(callsign string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.pending[callsign]
+}
+
+// Must hold mu.
 func (o *Outbox) nextCheck() time.Duration {
 	if len(o.outbox) == 0 {
 		return time.Minute
@@ -72,52 +281,67 @@ func (o *Outbox) nextCheck() time.Duration {
 }
 
 func (o *Outbox) loop(ctx context.Context) {
-	idReset := time.NewTimer(IDResetInterval)
 	nextCheck := time.NewTimer(time.Minute)
 	for {
+		o.mu.Lock()
 		nextCheck.Reset(o.nextCheck())
+		o.mu.Unlock()
+
+		var send []*Message
 		select {
 		case <-ctx.Done():
 			return
 		case msg := <-o.sendc:
-			idReset.Reset(IDResetInterval)
-			msg.ID = o.idGen
-			o.idGen += 1
-			o.outbox[msg.ID] = msg
-			msg.SentAt = time.Now()
-			o.attemptMessage(msg)
-
-		case an := <-o.ackc:
-			msg, ok := o.outbox[an]
-			if !ok {
-				continue // Message already received probably.
+			if msg.Addr == nil {
+				send = append(send, msg)
+				break
+			}
+			o.mu.Lock()
+			if _, ok := o.outbox[msg.ID]; ok && msg.Attempts == 0 && o.attemptMessage(msg) {
+				send = append(send, msg)
 			}
-			msg.Received = true
-			msg.ReceivedAt = time.Now()
-			msg.NextAttemptAt = time.Time{}
-			msg.donec <- true
-			log.Infof("Acknowledged message ID#%d", msg.ID)
-			delete(o.outbox, msg.ID)
+			o.mu.Unlock()
 
 		case <-nextCheck.C:
+			o.mu.Lock()
+			o.pruneHeard(time.Now())
 			for _, msg := range o.outbox {
-				if !msg.NextAttemptAt.After(time.Now()) {
-					o.attemptMessage(msg)
+				if !msg.NextAttemptAt.After(time.Now()) && o.attemptMessage(msg) {
+					send = append(send, msg)
 				}
 			}
+			o.mu.Unlock()
+		}
 
-		case <-idReset.C:
-			o.idGen = 1
+		// Transmit without holding the lock, as this waits for a client.
+		for _, msg := range send {
+			select {
+			case o.outc <- msg:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
 }
 
 func (o *Outbox) Run(ctx context.Context, wg *sync.WaitGroup) {
-	o.ackc = make(chan int)
 	o.sendc = make(chan *Message)
 	o.outc = make(chan *Message)
-	o.outbox = make(map[int]*Message)
-	o.idGen = 1
+	o.outbox = make(map[string]*Message)
+	o.pending = make(map[string]int)
+	o.heard = make(map[string]time.Time)
+	o.heardWithin = DefaultRetryPolicy.HeardWithin
+	if o.RetryPolicy != nil {
+		o.heardWithin = o.RetryPolicy.HeardWithin
+	}
+	if o.IDPrefix == "" {
+		for i := 0; i < IDPrefixLength; i++ {
+			o.IDPrefix += string(idChars[rand.Intn(len(idChars))])
+		}
+	}
+	// Start at a random sequence, so that restarts do not reuse recent IDs.
+	o.idSeq = rand.Intn(o.idSpace())
+	log.Infof("Outbox message IDs prefixed %q", o.IDPrefix)
 
 	wg.Add(1)
 	go func() {
@@ -126,20 +350,219 @@ func (o *Outbox) Run(ctx context.Context, wg *sync.WaitGroup) {
 	}()
 }
 
-func (o *Outbox) Ack(id int) {
-	o.ackc <- id
+// ValidateIDPrefix checks that prefix leaves room for a sequence within an
+// APRS message ID.
+func ValidateIDPrefix(prefix string) error {
+	if len(prefix) >= MaxIDLength-1 {
+		return fmt.Errorf("message ID prefix %q too long, at most %d characters", prefix, MaxIDLength-2)
+	}
+	for _, c := range prefix {
+		if !strings.ContainsRune(idChars, c) {
+			return fmt.Errorf("message ID prefix %q must be uppercase alphanumeric", prefix)
+		}
+	}
+	return nil
+}
+
+// idSpace returns the number of sequence values after the prefix.
+func (o *Outbox) idSpace() int {
+	n := 1
+	for i := len(o.IDPrefix); i < MaxIDLength; i++ {
+		n *= len(idChars)
+	}
+	return n
+}
+
+// nextID returns an unused message ID. Must hold mu.
+func (o *Outbox) nextID() string {
+	for {
+		o.idSeq = (o.idSeq + 1) % o.idSpace()
+		var seq []byte
+		for n, i := o.idSeq, len(o.IDPrefix); i < MaxIDLength; i++ {
+			seq = append([]byte{idChars[n%len(idChars)]}, seq...)
+			n /= len(idChars)
+		}
+		id := o.IDPrefix + string(seq)
+		if _, ok := o.outbox[id]; !ok {
+			return id
+		}
+	}
+}
+
+// lookup returns the pending message with the ID, if addressed to the
+// callsign. Must hold mu.
+func (o *Outbox) lookup(callsign, id string) (*Message, bool) {
+	msg, ok := o.outbox[id]
+	if !ok || msg.Addr.String() != callsign {
+		return nil, false
+	}
+	return msg, true
+}
+
+// Ack completes a message acknowledged by the recipient.
+func (o *Outbox) Ack(from, id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg, ok := o.lookup(from, id)
+	if !ok {
+		return // Message already received probably, or not ours.
+	}
+	msg.Received = true
+	msg.ReceivedAt = time.Now()
+	log.Infof("Acknowledged message ID#%s", msg.ID)
+	o.finish(msg, EventAcked)
+}
+
+// Reject completes a message rejected by the recipient.
+func (o *Outbox) Reject(from, id string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg, ok := o.lookup(from, id)
+	if !ok {
+		return
+	}
+	log.Warnf("Rejected message ID#%s", msg.ID)
+	o.finish(msg, EventRejected)
+}
+
+// Cancel stops retrying a message.
+func (o *Outbox) Cancel(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg, ok := o.outbox[id]
+	if !ok {
+		return ErrNotFound
+	}
+	log.Infof("Cancelled message ID#%s", msg.ID)
+	o.finish(msg, EventCancelled)
+	return nil
+}
+
+// Get returns a snapshot of a pending message.
+func (o *Outbox) Get(id string) (*Message, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msg, ok := o.outbox[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return msg.snapshot(), nil
+}
+
+// List returns snapshots of every pending message, oldest first.
+func (o *Outbox) List() []*Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var msgs []*Message
+	for _, msg := range o.outbox {
+		msgs = append(msgs, msg.snapshot())
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].SentAt.Before(msgs[j].SentAt)
+	})
+	return msgs
+}
+
+// Subscribe returns a channel of message events, closed when the context is
+// done.
+func (o *Outbox) Subscribe(ctx context.Context) <-chan Event {
+	c := make(chan Event, SubscriberBuffer)
+	o.mu.Lock()
+	o.subs = append(o.subs, c)
+	o.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		for i, s := range o.subs {
+			if s == c {
+				o.subs = append(o.subs[:i], o.subs[i+1:]...)
+				break
+			}
+		}
+		close(c)
+	}()
+	return c
 }
 
 func (o *Outbox) Outbound() <-chan *Message {
 	return o.outc
 }
 
-func (o *Outbox) Send(addr *aprs.Address, message string) *Message {
+// Send queues a message for delivery, returning an error if the governor
+// blocks it.
+func (o *Outbox) Send(addr *aprs.Address, message string, opts ...SendOption) (*Message, error) {
 	m := &Message{
 		Addr:    addr,
 		Message: message,
-		donec:   make(chan bool, 1),
+		Policy:  o.RetryPolicy,
+		done:    make(chan struct{}),
+	}
+	if m.Policy == nil {
+		m.Policy = DefaultRetryPolicy
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if o.Governor != nil {
+		admit := o.Governor.Admit
+		if m.Operator {
+			admit = o.Governor.AdmitOperator
+		}
+		if err := admit(addr.String(), message); err != nil {
+			return nil, err
+		}
+	}
+
+	o.mu.Lock()
+	if m.Policy.HeardWithin > o.heardWithin {
+		o.heardWithin = m.Policy.HeardWithin
+	}
+	m.ID = o.nextID()
+	m.SentAt = time.Now()
+	m.Schedule = m.Policy.Schedule(m.SentAt)
+	log.Debugf("Message ID#%s attempts scheduled at %v", m.ID, m.Schedule)
+	o.add(m)
+	o.publish(EventQueued, m)
+	o.mu.Unlock()
+
+	// Wake the loop for the first attempt.
+	o.sendc <- m
+	return m, nil
+}
+
+// SendAck queues an ack for a message received from the station. Acks are
+// not rate limited, as withholding one only provokes retransmissions.
+func (o *Outbox) SendAck(ctx context.Context, to *aprs.Address, id string) error {
+	if id == "" {
+		return fmt.Errorf("no message ID to ack")
+	}
+	m := &Message{
+		Message: fmt.Sprintf(":%-9s:ack%s", to.String(), id),
+		Trigger: to.String() + ":" + id,
+		Rule:    "ack",
+	}
+	select {
+	case o.sendc <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Broadcast queues an unacknowledged packet with the given information
+// field, e.g. a status or beacon, returning an error if the governor blocks
+// it.
+func (o *Outbox) Broadcast(info string, opts ...SendOption) error {
+	if o.Governor != nil && !o.Governor.AllowBroadcast() {
+		return ErrBroadcastRate
+	}
+	m := &Message{
+		Message: info,
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
 	o.sendc <- m
-	return m
+	return nil
 }
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxPruneHeard(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	o := &Outbox{
+		heard: map[string]time.Time{
+			"K1ABC":  now.Add(-5 * time.Minute),
+			"W1XYZ":  now.Add(-20 * time.Minute),
+			"N0CALL": now.Add(-2 * time.Hour),
+		},
+		heardWithin: 10 * time.Minute,
+	}
+	o.pruneHeard(now)
+	if len(o.heard) != 1 {
+		t.Fatalf("heard = %v, want only K1ABC", o.heard)
+	}
+	if _, ok := o.heard["K1ABC"]; !ok {
+		t.Errorf("K1ABC heard within the window was pruned")
+	}
+
+	// Without any HeardWithin policy nothing needs to be kept.
+	o.heardWithin = 0
+	o.pruneHeard(now.Add(time.Minute))
+	if len(o.heard) != 0 {
+		t.Errorf("heard = %v, want empty", o.heard)
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy schedules retransmissions of an unacknowledged message.
+type RetryPolicy struct {
+	// Interval is the delay before the first retry, multiplied by
+	// Multiplier for each following retry up to MaxInterval.
+	Interval    time.Duration
+	Multiplier  float64
+	MaxInterval time.Duration
+	// MaxAttempts counts every transmission, including the first.
+	MaxAttempts int
+	// Jitter randomizes each delay by up to this fraction, so stations
+	// messaging each other do not collide repeatedly.
+	Jitter float64
+	// MaxLifetime bounds the time from first to last attempt, if set.
+	MaxLifetime time.Duration
+	// HeardWithin stops retries once the recipient has not been heard
+	// within this duration, if set.
+	HeardWithin time.Duration
+}
+
+var (
+	// DefaultRetryPolicy decays retries as recommended by APRS 1.1,
+	// doubling the interval after each unacknowledged attempt.
+	DefaultRetryPolicy = &RetryPolicy{
+		Interval:    AttemptInterval,
+		Multiplier:  2,
+		MaxInterval: 10 * time.Minute,
+		MaxAttempts: MaxAttempts,
+		Jitter:      0.1,
+		MaxLifetime: 30 * time.Minute,
+	}
+
+	// FixedRetryPolicy retries at a fixed interval.
+	FixedRetryPolicy = &RetryPolicy{
+		Interval:    AttemptInterval,
+		Multiplier:  1,
+		MaxAttempts: MaxAttempts,
+	}
+)
+
+// Schedule returns the time of each attempt of a message first sent at
+// start, including the first.
+func (p *RetryPolicy) Schedule(start time.Time) []time.Time {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	schedule := []time.Time{start}
+	t, d := start, p.Interval
+	for len(schedule) < attempts {
+		jittered := d
+		if p.Jitter > 0 {
+			jittered += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+		}
+		t = t.Add(jittered)
+		if p.MaxLifetime > 0 && t.Sub(start) > p.MaxLifetime {
+			break
+		}
+		schedule = append(schedule, t)
+
+		if p.Multiplier > 1 {
+			d = time.Duration(float64(d) * p.Multiplier)
+		}
+		if p.MaxInterval > 0 && d > p.MaxInterval {
+			d = p.MaxInterval
+		}
+	}
+	return schedule
+}
+
+// WithRetryPolicy selects the retry policy for a message.
+func WithRetryPolicy(p *RetryPolicy) SendOption {
+	return func(m *Message) {
+		m.Policy = p
+	}
+}
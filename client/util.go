@@ -2,9 +2,29 @@ package client
 
 import (
 	"context"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/jheidel/go-aprs"
 )
 
+// MaxMessageLength is the longest text which fits in an APRS message.
+const MaxMessageLength = 67
+
+// Truncate shortens text to fit in an APRS message, without splitting a
+// UTF-8 encoded character.
+func Truncate(text string) string {
+	if len(text) <= MaxMessageLength {
+		return text
+	}
+	n := MaxMessageLength
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
 // sleep performs a delay, respecting context cancellation
 func sleep(ctx context.Context, d time.Duration) {
 	select {
@@ -12,3 +32,61 @@ func sleep(ctx context.Context, d time.Duration) {
 	case <-ctx.Done():
 	}
 }
+
+// responseID returns the message ID of an ack or rej message, as selected by
+// kind. IDs are up to five alphanumeric characters, optionally followed by an
+// APRS 1.1 reply-ack.
+func responseID(p *aprs.Packet, kind string) (string, bool) {
+	if p.MessageTo == nil || !strings.HasPrefix(p.Message, kind) {
+		return "", false
+	}
+	id := strings.TrimSpace(strings.TrimPrefix(p.Message, kind))
+	if i := strings.Index(id, "}"); i != -1 {
+		id = id[:i]
+	}
+	if id == "" || len(id) > MaxIDLength {
+		return "", false
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(idChars, c) && !strings.ContainsRune("abcdefghijklmnopqrstuvwxyz", c) {
+			return "", false
+		}
+	}
+	return id, true
+}
+
+// messageID returns the ID of a message packet addressed to another station,
+// or the empty string if it has none. Any APRS 1.1 reply-ack is dropped.
+func messageID(p *aprs.Packet) string {
+	if p.MessageTo == nil || p.MessageTo.String() == p.Src.String() {
+		return ""
+	}
+	i := strings.Index(p.Raw, ":")
+	if i == -1 {
+		return ""
+	}
+	// Message information field is :ADDRESSEE:text{ID
+	info := p.Raw[i+1:]
+	if len(info) < 11 || info[0] != ':' || info[10] != ':' {
+		return ""
+	}
+	text := info[11:]
+	j := strings.LastIndex(text, "{")
+	if j == -1 {
+		return ""
+	}
+	id := strings.TrimSpace(text[j+1:])
+	if k := strings.Index(id, "}"); k != -1 {
+		id = id[:k]
+	}
+	if len(id) > MaxIDLength {
+		return ""
+	}
+	return id
+}
+
+// IsBulletin returns whether a message addressee is a general or group
+// bulletin, e.g. BLN1 or BLN1TRAIL.
+func IsBulletin(addressee string) bool {
+	return strings.HasPrefix(strings.ToUpper(addressee), "BLN")
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"RX 3:04 PM", "RX 3:04 PM"},
+		{strings.Repeat("a", 67), strings.Repeat("a", 67)},
+		{strings.Repeat("a", 70), strings.Repeat("a", 67)},
+		// A two byte character straddling the limit is dropped whole.
+		{strings.Repeat("a", 66) + "é", strings.Repeat("a", 66)},
+		{strings.Repeat("a", 65) + "é!", strings.Repeat("a", 65) + "é"},
+	}
+	for _, tt := range tests {
+		got := Truncate(tt.text)
+		if got != tt.want {
+			t.Errorf("Truncate(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("Truncate(%q) = %q is not valid UTF-8", tt.text, got)
+		}
+	}
+}
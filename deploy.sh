@@ -13,7 +13,9 @@ docker run \
         -d --restart always \
         --name jheidel-aprs \
         --mount type=bind,source=/etc/jheidel-aprs,target=/etc/jheidel-aprs \
+        --mount type=volume,source=jheidel-aprs-state,target=/var/lib/jheidel-aprs \
         --env "DOCKER_HOST=$( hostname )" \
+        --env-file /etc/jheidel-aprs/env \
         jheidel/jheidel-aprs
 
 sleep 3
@@ -2,10 +2,19 @@ package email
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
 	"jheidel-aprs/email/types"
 	"jheidel-aprs/firebase"
 )
@@ -13,36 +22,123 @@ import (
 type Auth struct {
 	Firebase *firebase.Firebase
 
+	// ClientFile is an optional path to the OAuth client JSON downloaded from
+	// the Google cloud console. If unset, the client ID and secret are read
+	// from the EMAIL_CLIENT_ID and EMAIL_CLIENT_SECRET environment variables.
+	ClientFile string
+
+	// ListenAddr is the loopback address which receives the OAuth redirect.
+	ListenAddr string
+
 	creds *types.Credentials
 }
 
+// redact hides all but a short prefix of a secret for logging.
+func redact(s string) string {
+	if len(s) <= 4 {
+		return "****"
+	}
+	return s[:4] + "****"
+}
+
+func (a *Auth) loadClient() (*types.Credentials, error) {
+	c := &types.Credentials{
+		ClientID:     os.Getenv("EMAIL_CLIENT_ID"),
+		ClientSecret: os.Getenv("EMAIL_CLIENT_SECRET"),
+	}
+	if a.ClientFile != "" {
+		b, err := os.ReadFile(a.ClientFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg, err := google.ConfigFromJSON(b)
+		if err != nil {
+			// Also accept a plain {"client_id": ..., "client_secret": ...} file.
+			var raw struct {
+				ClientID     string `json:"client_id"`
+				ClientSecret string `json:"client_secret"`
+			}
+			if jerr := json.Unmarshal(b, &raw); jerr != nil {
+				return nil, fmt.Errorf("client file %q: %v", a.ClientFile, err)
+			}
+			c.ClientID, c.ClientSecret = raw.ClientID, raw.ClientSecret
+		} else {
+			c.ClientID, c.ClientSecret = cfg.ClientID, cfg.ClientSecret
+		}
+	}
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return nil, errors.New("missing client ID or secret, provide a client file or EMAIL_CLIENT_ID and EMAIL_CLIENT_SECRET")
+	}
+	return c, nil
+}
+
+// awaitCode serves the loopback redirect and returns the authorization code.
+func awaitCode(ctx context.Context, lis net.Listener, state string) (string, error) {
+	codec := make(chan string, 1)
+	errc := make(chan error, 1)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			if q.Get("state") != state {
+				http.Error(w, "state mismatch", http.StatusBadRequest)
+				return
+			}
+			if e := q.Get("error"); e != "" {
+				http.Error(w, e, http.StatusBadRequest)
+				errc <- fmt.Errorf("authorization denied: %s", e)
+				return
+			}
+			fmt.Fprintf(w, "Authorization complete, you may close this window.\n")
+			codec <- q.Get("code")
+		}),
+	}
+	go srv.Serve(lis)
+	defer srv.Close()
+
+	select {
+	case code := <-codec:
+		return code, nil
+	case err := <-errc:
+		return "", err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
 func (a *Auth) Generate(ctx context.Context) error {
-	c := &types.Credentials{}
 	log.Infof("Conducting auth key generation")
 
-	fmt.Printf("Enter Client ID: ")
-	if _, err := fmt.Scan(&c.ClientID); err != nil {
+	c, err := a.loadClient()
+	if err != nil {
+		return err
+	}
+	log.Infof("Using client ID %q, secret %q", c.ClientID, redact(c.ClientSecret))
+
+	addr := a.ListenAddr
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
 		return err
 	}
-	log.Infof("Accepted ID %q", c.ClientID)
+	c.RedirectURL = fmt.Sprintf("http://%s/", lis.Addr().String())
 
-	fmt.Printf("Enter Client Secret: ")
-	if _, err := fmt.Scan(&c.ClientSecret); err != nil {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
 		return err
 	}
-	log.Infof("Accepted secret %q", c.ClientSecret)
+	state := hex.EncodeToString(b)
 
-	url := c.Config().AuthCodeURL("state", oauth2.AccessTypeOffline, oauth2.ApprovalForce)
-	fmt.Printf("Visit the URL for the auth dialog: %v\n", url)
-	fmt.Printf("Enter access code: ")
+	url := c.Config().AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+	log.Infof("Visit the URL for the auth dialog (forward %s if remote): %v", lis.Addr(), url)
 
-	var code string
-	if _, err := fmt.Scan(&code); err != nil {
+	code, err := awaitCode(ctx, lis, state)
+	if err != nil {
 		return err
 	}
+	log.Infof("Accepted code %q", redact(code))
 
-	log.Infof("Accepted code %q", code)
-	var err error
 	c.Token, err = c.Config().Exchange(ctx, code)
 	if err != nil {
 		return err
@@ -57,6 +153,43 @@ func (a *Auth) Generate(ctx context.Context) error {
 	return nil
 }
 
+// persistingTokenSource stores refreshed tokens back to firebase and reports
+// auth health, so that a revoked refresh token raises an alert.
+type persistingTokenSource struct {
+	ctx  context.Context
+	auth *Auth
+	src  oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.src.Token()
+	if err != nil {
+		var rerr *oauth2.RetrieveError
+		if errors.As(err, &rerr) && rerr.ErrorCode == "invalid_grant" {
+			err = fmt.Errorf("refresh token revoked or expired, rerun --email_auth: %v", err)
+		}
+		s.auth.Firebase.SetHealth("email_auth", err)
+		return nil, err
+	}
+	s.auth.Firebase.SetHealth("email_auth", nil)
+
+	if t.AccessToken != s.last {
+		s.last = t.AccessToken
+		log.Debugf("Persisting refreshed email token (expires %v)", t.Expiry)
+		s.auth.creds.Token = t
+		if err := s.auth.Firebase.StoreCredentials(s.ctx, s.auth.creds); err != nil {
+			log.Errorf("Failed to persist refreshed email token: %v", err)
+		}
+	}
+	return t, nil
+}
+
 func (a *Auth) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
 	if a.creds == nil {
 		var err error
@@ -65,5 +198,14 @@ func (a *Auth) TokenSource(ctx context.Context) (oauth2.TokenSource, error) {
 			return nil, err
 		}
 	}
-	return a.creds.Config().TokenSource(ctx, a.creds.Token), nil
+	if a.creds.Token == nil {
+		return nil, errors.New("no email token stored, run --email_auth")
+	}
+	src := a.creds.Config().TokenSource(ctx, a.creds.Token)
+	return &persistingTokenSource{
+		ctx:  ctx,
+		auth: a,
+		src:  src,
+		last: a.creds.Token.AccessToken,
+	}, nil
 }
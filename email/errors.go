@@ -0,0 +1,81 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+type ErrorClass string
+
+const (
+	ClassAuth      ErrorClass = "auth"
+	ClassQuota     ErrorClass = "quota"
+	ClassTransient ErrorClass = "transient"
+	ClassParse     ErrorClass = "parse"
+)
+
+var ErrorClasses = []ErrorClass{ClassAuth, ClassQuota, ClassTransient, ClassParse}
+
+// Error is an email subsystem error tagged with its class, which determines
+// how the service recovers from it.
+type Error struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s error: %v", e.Class, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func parseError(err error) error {
+	return &Error{Class: ClassParse, Err: err}
+}
+
+// classify determines the class of an error returned by the gmail API.
+func classify(err error) ErrorClass {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Class
+	}
+	var rerr *oauth2.RetrieveError
+	if errors.As(err, &rerr) {
+		return ClassAuth
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case 401:
+			return ClassAuth
+		case 429:
+			return ClassQuota
+		case 403:
+			for _, item := range gerr.Errors {
+				switch item.Reason {
+				case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded", "dailyLimitExceeded":
+					return ClassQuota
+				}
+			}
+			return ClassAuth
+		}
+	}
+	return ClassTransient
+}
+
+// classified wraps err with its class, if not already classified.
+func classified(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Class: classify(err), Err: err}
+}
@@ -0,0 +1,236 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"jheidel-aprs/email/types"
+)
+
+const (
+	ReplyAttemptInterval = 30 * time.Second
+	ReplyMaxAttempts     = 5
+	// SendTimeout bounds a single delivery attempt, so that a stalled server
+	// can't hold up the caller indefinitely.
+	SendTimeout = 30 * time.Second
+
+	InReachReplyEndpoint = "https://explore.garmin.com/TextMessage/TxtMsg"
+)
+
+// Sender delivers a text reply to the originator of an email packet.
+type Sender interface {
+	// Name identifies the delivery method, e.g. for reporting.
+	Name() string
+	// CanReply returns whether this sender is able to reply to the email.
+	CanReply(e *types.Email) bool
+	Send(ctx context.Context, e *types.Email, text string) error
+}
+
+// InReachSender replies through the form post behind the reply link that
+// Garmin inReach devices include in their messages.
+type InReachSender struct {
+	Client *http.Client
+}
+
+func (s *InReachSender) Name() string {
+	return "inreach"
+}
+
+func (s *InReachSender) CanReply(e *types.Email) bool {
+	return e.ReplyURL != ""
+}
+
+func (s *InReachSender) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return &http.Client{Timeout: SendTimeout}
+}
+
+// resolve follows any short link redirects to the reply page and returns
+// its query parameters.
+func (s *InReachSender) resolve(ctx context.Context, link string) (url.Values, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Request.URL.Query(), nil
+}
+
+func (s *InReachSender) Send(ctx context.Context, e *types.Email, text string) error {
+	q, err := s.resolve(ctx, e.ReplyURL)
+	if err != nil {
+		return fmt.Errorf("resolve reply link: %v", err)
+	}
+	guid, addr := q.Get("extId"), q.Get("adr")
+	if guid == "" || addr == "" {
+		return fmt.Errorf("reply link %q missing extId or adr", e.ReplyURL)
+	}
+
+	form := url.Values{
+		"ReplyAddress": {addr},
+		"ReplyMessage": {text},
+		"MessageId":    {strconv.Itoa(rand.Intn(1e9))},
+		"Guid":         {guid},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", InReachReplyEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("reply post failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPSender replies by email to the sender address of the message.
+type SMTPSender struct {
+	// Addr is the host:port of the SMTP server.
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPSender) CanReply(e *types.Email) bool {
+	return s.Addr != "" && e.From != ""
+}
+
+// SendMail delivers a plain text message to a single recipient. Unlike
+// smtp.SendMail the whole exchange is bounded by SendTimeout.
+func (s *SMTPSender) SendMail(ctx context.Context, to, subject, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, SendTimeout)
+	defer cancel()
+
+	host := s.Addr
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		host = host[:i]
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", s.From, to, subject, body)
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *SMTPSender) Send(ctx context.Context, e *types.Email, text string) error {
+	addr, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return fmt.Errorf("bad sender address %q: %v", e.From, err)
+	}
+	return s.SendMail(ctx, addr.Address, "Re: inReach message", text)
+}
+
+// Replier delivers replies to email-originated packets, using the first
+// sender able to reply to each message.
+type Replier struct {
+	Senders []Sender
+}
+
+// Send delivers text as a reply to e, retrying on failure. It blocks until
+// the reply is delivered or attempts are exhausted.
+func (r *Replier) Send(ctx context.Context, e *types.Email, text string) *types.Reply {
+	reply := &types.Reply{
+		Message: text,
+		SentAt:  time.Now(),
+	}
+
+	var sender Sender
+	for _, s := range r.Senders {
+		if s.CanReply(e) {
+			sender = s
+			break
+		}
+	}
+	if sender == nil {
+		reply.Error = "no reply method available"
+		return reply
+	}
+	reply.Method = sender.Name()
+
+	for reply.Attempts < ReplyMaxAttempts && ctx.Err() == nil {
+		reply.Attempts += 1
+		reply.LastSentAt = time.Now()
+		log.Infof("Sending %s reply to email %q (attempt %d)", reply.Method, e.ID, reply.Attempts)
+		err := sender.Send(ctx, e, text)
+		if err == nil {
+			reply.Delivered = true
+			reply.DeliveredAt = time.Now()
+			reply.Error = ""
+			return reply
+		}
+		log.Warnf("Failed %s reply to email %q: %v", reply.Method, e.ID, err)
+		reply.Error = err.Error()
+		if reply.Attempts < ReplyMaxAttempts {
+			select {
+			case <-time.After(ReplyAttemptInterval):
+			case <-ctx.Done():
+			}
+		}
+	}
+	return reply
+}
@@ -8,6 +8,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/api/gmail/v1"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"jheidel-aprs/email/types"
 	"jheidel-aprs/firebase"
 )
@@ -17,25 +19,48 @@ const (
 	UserID       = "inreach@jeffheidel.com"
 
 	CacheTTL = 7 * 24 * time.Hour
+
+	// Processed records are kept well beyond the newer_than:1d search window,
+	// and expired every ProcessedExpireInterval.
+	ProcessedTTL            = 3 * 24 * time.Hour
+	ProcessedExpireInterval = time.Hour
+
+	// Per-message retry schedule before a message is quarantined.
+	FetchRetryMin    = 30 * time.Second
+	FetchRetryMax    = 30 * time.Minute
+	FetchMaxAttempts = 6
+
+	// Upper bound on the poll delay after repeated poll failures.
+	PollBackoffMax = 15 * time.Minute
 )
 
+// fetchFailure tracks retries of a single message which failed processing.
+type fetchFailure struct {
+	attempts int
+	next     time.Time
+	err      error
+}
+
 type Service struct {
 	Auth     *Auth
 	Firebase *firebase.Firebase
 
-	ms    *gmail.UsersMessagesService
-	cache map[string]time.Time
+	ms       *gmail.UsersMessagesService
+	cache    map[string]time.Time
+	failures map[string]*fetchFailure
+	inbound  chan *types.Email
+	expired  time.Time
 }
 
 func (s *Service) fetchMail(ctx context.Context, ID string) (*types.Email, error) {
 	m, err := s.ms.Get(UserID, ID).Do()
 	if err != nil {
-		return nil, err
+		return nil, classified(err)
 	}
 
 	text, err := toPlainText(m)
 	if err != nil {
-		return nil, err
+		return nil, parseError(err)
 	}
 
 	log.Debugf("Got mail--\n%s", text)
@@ -47,10 +72,12 @@ func (s *Service) fetchMail(ctx context.Context, ID string) (*types.Email, error
 
 	e := &types.Email{
 		ID:          m.Id,
+		From:        header(m, "From"),
 		Time:        time.Unix(m.InternalDate/1000, 0),
 		FullMessage: text,
 		Message:     toMessage(text),
 		Position:    coords,
+		ReplyURL:    extractReplyURL(text),
 	}
 	return e, nil
 }
@@ -63,65 +90,210 @@ func (s *Service) cleanCache() {
 	}
 }
 
+// retryDelay returns the backoff before the given retry attempt.
+func retryDelay(attempts int) time.Duration {
+	d := FetchRetryMin
+	for i := 1; i < attempts && d < FetchRetryMax; i++ {
+		d *= 2
+	}
+	if d > FetchRetryMax {
+		d = FetchRetryMax
+	}
+	return d
+}
+
+// markProcessed records that a message needs no further handling.
+func (s *Service) markProcessed(ctx context.Context, id string) {
+	s.cleanCache()
+	s.cache[id] = time.Now()
+	delete(s.failures, id)
+	if err := s.Firebase.MarkEmailProcessed(ctx, id); err != nil {
+		log.Warnf("Failed to persist processed email %q: %v", id, err)
+	}
+}
+
+// messageFailed schedules a retry of a message, or quarantines it once
+// retries are exhausted. Parse errors will fail the same way every time, so
+// those messages are quarantined at once.
+func (s *Service) messageFailed(ctx context.Context, id string, err error) {
+	f, ok := s.failures[id]
+	if !ok {
+		f = &fetchFailure{}
+		s.failures[id] = f
+	}
+	f.attempts += 1
+	f.err = err
+	if f.attempts < FetchMaxAttempts && classify(err) != ClassParse {
+		f.next = time.Now().Add(retryDelay(f.attempts))
+		log.Warnf("Failed to process email %q (attempt %d), retry at %v: %v", id, f.attempts, f.next, err)
+		return
+	}
+
+	log.Errorf("Quarantining email %q after %d attempts: %v", id, f.attempts, err)
+	q := &firebase.EmailQuarantine{
+		ID:            id,
+		Class:         string(classify(err)),
+		Error:         err.Error(),
+		Attempts:      f.attempts,
+		QuarantinedAt: time.Now(),
+	}
+	if err := s.Firebase.QuarantineEmail(ctx, q); err != nil {
+		log.Errorf("Failed to quarantine email %q: %v", id, err)
+		return // Try again next poll.
+	}
+	s.markProcessed(ctx, id)
+}
+
 func (s *Service) runOnce(ctx context.Context) error {
 	// Connect to service if not already connected
 	if s.ms == nil {
 		log.Debugf("Connecting to gmail service")
 		ts, err := s.Auth.TokenSource(ctx)
 		if err != nil {
-			return err
+			return &Error{Class: ClassAuth, Err: err}
 		}
 		gs, err := gmail.NewService(ctx, option.WithTokenSource(ts))
 		if err != nil {
-			return err
+			return classified(err)
 		}
 		s.ms = gmail.NewUsersMessagesService(gs)
 	}
 
 	log.Debugf("Checking for email messages")
 
-	list, err := s.ms.List(UserID).Q("label:inreach newer_than:1d").Do()
-	if err != nil {
-		log.Fatal(err)
+	var ids []string
+	call := s.ms.List(UserID).Q("label:inreach newer_than:1d")
+	for {
+		list, err := call.Do()
+		if err != nil {
+			return classified(err)
+		}
+		for _, m := range list.Messages {
+			ids = append(ids, m.Id)
+		}
+		if list.NextPageToken == "" {
+			break
+		}
+		call.PageToken(list.NextPageToken)
 	}
 
-	for _, m := range list.Messages {
-		if _, ok := s.cache[m.Id]; ok {
+	for _, id := range ids {
+		if _, ok := s.cache[id]; ok {
 			continue // Already dealt with this one.
 		}
-		log.Debugf("Found email message ID %q", m.Id)
-
-		mail, err := s.fetchMail(ctx, m.Id)
+		if f, ok := s.failures[id]; ok && time.Now().Before(f.next) {
+			continue // Waiting to retry.
+		}
+		done, err := s.Firebase.EmailProcessed(ctx, id)
 		if err != nil {
-			return err
+			return &Error{Class: ClassTransient, Err: err}
 		}
+		if done {
+			// Handled before a restart.
+			s.cache[id] = time.Now()
+			continue
+		}
+		log.Debugf("Found email message ID %q", id)
 
-		s.cleanCache()
-		s.cache[m.Id] = time.Now()
+		mail, err := s.fetchMail(ctx, id)
+		if err != nil {
+			switch classify(err) {
+			case ClassAuth, ClassQuota:
+				// Not specific to this message, abandon the batch.
+				return err
+			}
+			s.messageFailed(ctx, id, err)
+			continue
+		}
 
+		// The stored packet is the durable record of the email, so it is only
+		// marked processed once stored.
 		if err := s.Firebase.ReportEmail(ctx, mail); err != nil {
-			log.Warnf("Failed to save email: %v", err)
+			if status.Code(err) == codes.AlreadyExists {
+				// Stored before a restart, or by another instance.
+				s.markProcessed(ctx, id)
+				continue
+			}
+			s.messageFailed(ctx, id, &Error{Class: ClassTransient, Err: err})
+			continue
+		}
+		s.markProcessed(ctx, id)
+
+		select {
+		case s.inbound <- mail:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	if time.Since(s.expired) > ProcessedExpireInterval {
+		s.expired = time.Now()
+		n, err := s.Firebase.ExpireEmailProcessed(ctx, time.Now().Add(-ProcessedTTL))
+		if err != nil {
+			log.Warnf("Failed to expire processed email records: %v", err)
+		} else if n > 0 {
+			log.Infof("Expired %d processed email records", n)
 		}
 	}
 
 	return nil
 }
 
+// reportHealth sets health for the overall email module and for each error
+// class individually. A class is unhealthy while the poll fails with it or
+// any message awaiting retry last failed with it, so that health holds
+// steady between retries.
+func (s *Service) reportHealth(err error) {
+	classErrs := make(map[ErrorClass]error)
+	for _, f := range s.failures {
+		classErrs[classify(f.err)] = f.err
+	}
+	if err != nil {
+		classErrs[classify(err)] = err
+	}
+	s.Firebase.SetHealth("email", err)
+	for _, c := range ErrorClasses {
+		s.Firebase.SetHealth("email_"+string(c), classErrs[c])
+	}
+}
+
 func (s *Service) Run(ctx context.Context, wg *sync.WaitGroup) {
 	s.cache = make(map[string]time.Time)
+	s.failures = make(map[string]*fetchFailure)
+	s.inbound = make(chan *types.Email)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		defer close(s.inbound)
+
+		// Consecutive failed polls, used to back off polling.
+		failed := 0
+		var resumeAt time.Time
+
 		f := func() {
+			if time.Now().Before(resumeAt) {
+				return
+			}
 			err := s.runOnce(ctx)
-			s.Firebase.SetHealth("email", err)
-			if err != nil {
-				log.Errorf("Failed email poll: %v", err)
-
-				// Force reconnect next time around
-				s.ms = nil
+			s.reportHealth(err)
+			if err == nil {
+				failed = 0
+				return
+			}
+			failed += 1
+			delay := PollInterval
+			for i := 1; i < failed && delay < PollBackoffMax; i++ {
+				delay *= 2
+			}
+			if delay > PollBackoffMax {
+				delay = PollBackoffMax
 			}
+			resumeAt = time.Now().Add(delay)
+			log.Errorf("Failed email poll, next attempt in %v: %v", delay, err)
+
+			// Force reconnect next time around
+			s.ms = nil
 		}
 		f()
 		t := time.NewTicker(PollInterval)
@@ -134,3 +306,8 @@ func (s *Service) Run(ctx context.Context, wg *sync.WaitGroup) {
 		}
 	}()
 }
+
+// Receive returns new emails, which have already been stored in firebase.
+func (s *Service) Receive() <-chan *types.Email {
+	return s.inbound
+}
@@ -1,6 +1,9 @@
 package types
 
 import (
+	"net/mail"
+	"strings"
+
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/genproto/googleapis/type/latlng"
@@ -11,22 +14,53 @@ type Credentials struct {
 	ClientID     string
 	ClientSecret string
 	Token        *oauth2.Token
+
+	// RedirectURL is the OAuth redirect used during authorization.
+	RedirectURL string
 }
 
 func (c *Credentials) Config() *oauth2.Config {
+	redirect := c.RedirectURL
+	if redirect == "" {
+		redirect = "https://where.jeffheidel.com/__/auth/handler"
+	}
 	return &oauth2.Config{
 		ClientID:     c.ClientID,
 		ClientSecret: c.ClientSecret,
 		Scopes:       []string{"https://www.googleapis.com/auth/gmail.readonly"},
 		Endpoint:     google.Endpoint,
-		RedirectURL:  "https://where.jeffheidel.com/__/auth/handler",
+		RedirectURL:  redirect,
 	}
 }
 
 type Email struct {
 	ID          string
+	From        string
 	Message     string
 	FullMessage string
 	Time        time.Time
 	Position    *latlng.LatLng
+
+	// ReplyURL is the device reply link included in the message, if any.
+	ReplyURL string
+}
+
+// Station identifies the sending device by its email address.
+func (e *Email) Station() string {
+	if a, err := mail.ParseAddress(e.From); err == nil {
+		return strings.ToLower(a.Address)
+	}
+	return e.From
+}
+
+// Reply tracks delivery of an outbound reply to an email-originated packet.
+type Reply struct {
+	Method      string
+	Message     string
+	SentAt      time.Time
+	LastSentAt  time.Time
+	Delivered   bool
+	DeliveredAt time.Time
+	Attempts    int
+	Error       string
 }
@@ -45,6 +45,26 @@ func toMessage(full string) string {
 	return strings.TrimSpace(full)
 }
 
+var (
+	ReplyURLRE = regexp.MustCompile(`(?i)https?://(?:\S+\.)?(?:garmin\.com/textmessage|inreachlink\.com)\S*`)
+)
+
+func extractReplyURL(full string) string {
+	return ReplyURLRE.FindString(full)
+}
+
+func header(m *gmail.Message, name string) string {
+	if m.Payload == nil {
+		return ""
+	}
+	for _, h := range m.Payload.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
 var (
 	CoordRE = regexp.MustCompile(`(?i)Lat\w*?\W+?([-0-9.]+).*?Lon\w*?\W+?([-0-9.]+)`)
 )
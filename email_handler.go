@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/email"
+	"jheidel-aprs/email/types"
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/geo"
+	"jheidel-aprs/observe"
+	"jheidel-aprs/policy"
+	"jheidel-aprs/reply"
+)
+
+type EmailHandler struct {
+	Service  *email.Service
+	Replier  *email.Replier
+	Firebase *firebase.Firebase
+	Observer observe.Observer
+	Policy   *policy.Decider
+	Replies  *reply.Builder
+}
+
+// emailObservation normalizes an email packet for station activity
+// subsystems.
+func emailObservation(e *types.Email) *observe.Observation {
+	return &observe.Observation{
+		Source:   observe.SourceEmail,
+		Station:  e.Station(),
+		PacketID: firebase.EmailPacketID(e),
+		Time:     e.Time,
+		Message:  e.Message,
+		Position: geo.FromLatLng(e.Position),
+		// Mail arrives in the gateway's own inbox.
+		ToGateway: true,
+	}
+}
+
+func (h *EmailHandler) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for ctx.Err() == nil {
+			e := <-h.Service.Receive()
+			if e == nil {
+				break
+			}
+
+			log.Debugf("Received email:\n%v", spew.Sdump(e))
+			log.Infof("EMAIL MESSAGE: %v", e.Message)
+
+			o := emailObservation(e)
+			h.Observer.Observe(ctx, o)
+
+			if !*respond {
+				continue // Transmit kill switch.
+			}
+			h.reply(ctx, e, o)
+		}
+	}()
+}
+
+// reply responds to the email under the sender's reply policy. Only device
+// messages, which carry a reply link, count as messages to the gateway;
+// other mail is treated like a beacon so that arbitrary senders, such as
+// auto-responders, get no reply unless their policy asks for one.
+func (h *EmailHandler) reply(ctx context.Context, e *types.Email, o *observe.Observation) {
+	isMessage := e.ReplyURL != ""
+	ok, pol := h.Policy.Decide(ctx, o.Station, isMessage, time.Now())
+	if !ok {
+		log.Debugf("Reply policy for %s declines reply", o.Station)
+		return
+	}
+	text, err := h.Replies.Build(ctx, pol, o, reply.Kind(o, isMessage))
+	if err != nil {
+		log.Errorf("Failed to build reply for %s: %v", o.Station, err)
+		return
+	}
+
+	log.Infof("EMAIL REPLY: %v", text)
+	go func() {
+		r := h.Replier.Send(ctx, e, text)
+		log.Infof("Email reply done %v", spew.Sdump(r))
+		if err := h.Firebase.ReportEmailReply(ctx, e, r); err != nil {
+			log.Errorf("Failed to report email reply to firebase; %v", err)
+		}
+	}()
+}
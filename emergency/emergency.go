@@ -0,0 +1,324 @@
+package emergency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/notify"
+	"jheidel-aprs/observe"
+)
+
+const (
+	RealertInterval = 5 * time.Minute
+)
+
+var (
+	// KeywordRE matches distress keywords. Matching is case-sensitive, so
+	// that ordinary uses like "happy to help" don't raise emergencies.
+	KeywordRE = regexp.MustCompile(`\b(SOS|HELP|MAYDAY|EMERGENCY)\b`)
+)
+
+// IsMicEEmergency returns whether a Mic-E encoded packet carries the
+// "Emergency" message code. The message bits are encoded in the first three
+// characters of the destination address, and emergency is all bits zero.
+func IsMicEEmergency(dst, info string) bool {
+	if info == "" || (info[0] != '`' && info[0] != '\'') {
+		return false // Not Mic-E
+	}
+	if len(dst) < 3 {
+		return false
+	}
+	for _, c := range dst[:3] {
+		if !(c >= '0' && c <= '9') && c != 'L' {
+			return false
+		}
+	}
+	return true
+}
+
+// Detect returns the reason the observation indicates an emergency, or the
+// empty string if it does not. Keywords only count in messages addressed to
+// the gateway, since beacon comments often mention e.g. "ARES EMERGENCY".
+func Detect(o *observe.Observation) string {
+	if o.Emergency != "" {
+		return o.Emergency
+	}
+	if !o.ToGateway {
+		return ""
+	}
+	if m := KeywordRE.FindString(o.Message); m != "" {
+		return fmt.Sprintf("keyword %q", m)
+	}
+	return ""
+}
+
+// entry is an active emergency with its persistence state.
+type entry struct {
+	*firebase.Emergency
+	// stored is set once the emergency exists in firebase.
+	stored bool
+	// changes counts updates, and saved is the count last stored.
+	changes, saved int
+}
+
+// Manager flags emergencies and keeps alerting on them until an operator
+// acknowledges them. Changes which fail to store are kept in memory and
+// retried, so alerting continues while firebase is unavailable.
+type Manager struct {
+	Firebase *firebase.Firebase
+	Notifier notify.Notifier
+
+	mu sync.Mutex
+	// active maps emergency ID to entry.
+	active map[string]*entry
+}
+
+// byStation returns the active emergency for a station, if any.
+func (m *Manager) byStation(station string) *entry {
+	for _, e := range m.active {
+		if e.Station == station {
+			return e
+		}
+	}
+	return nil
+}
+
+// save stores a snapshot of the emergency taken at the given change count.
+func (m *Manager) save(ctx context.Context, snap firebase.Emergency, changes int) {
+	if err := m.Firebase.StoreEmergency(ctx, &snap); err != nil {
+		log.Errorf("Failed to store emergency %s in firebase, will retry: %v", snap.ID, err)
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.active[snap.ID]; ok {
+		e.stored = true
+		if changes > e.saved {
+			e.saved = changes
+		}
+	}
+}
+
+// flush retries storing emergencies with unsaved changes.
+func (m *Manager) flush(ctx context.Context) {
+	type pending struct {
+		snap    firebase.Emergency
+		changes int
+	}
+	var ps []pending
+	m.mu.Lock()
+	for _, e := range m.active {
+		if e.changes != e.saved {
+			ps = append(ps, pending{*e.Emergency, e.changes})
+		}
+	}
+	m.mu.Unlock()
+	for _, p := range ps {
+		m.save(ctx, p.snap, p.changes)
+	}
+}
+
+func (m *Manager) alert(ctx context.Context, id string) {
+	m.mu.Lock()
+	e, ok := m.active[id]
+	if !ok {
+		m.mu.Unlock()
+		return // Acknowledged meanwhile.
+	}
+	e.AlertCount += 1
+	e.LastAlertAt = time.Now()
+	e.changes += 1
+	snap, changes := *e.Emergency, e.changes
+	m.mu.Unlock()
+
+	text := fmt.Sprintf("EMERGENCY %s: %s", snap.Station, snap.Reason)
+	if snap.AlertCount > 1 {
+		text = fmt.Sprintf("EMERGENCY %s unacked: %s", snap.Station, snap.Reason)
+	}
+	if snap.Place != "" {
+		text += ", " + snap.Place
+	}
+	log.Errorf("EMERGENCY: %s (%s) alert #%d", snap.Station, snap.Reason, snap.AlertCount)
+	m.Notifier.Notify(ctx, &notify.Notification{
+		Kind:     "emergency",
+		Priority: notify.PriorityHigh,
+		Station:  snap.Station,
+		PacketID: snap.PacketID,
+		Time:     snap.LastAlertAt,
+		Text:     text,
+	})
+	m.save(ctx, snap, changes)
+}
+
+func (m *Manager) Observe(ctx context.Context, o *observe.Observation) {
+	reason := Detect(o)
+	if reason == "" {
+		return
+	}
+	if err := m.Firebase.FlagEmergencyPacket(ctx, o.PacketID, reason); err != nil {
+		log.Errorf("Failed to flag emergency packet in firebase: %v", err)
+	}
+
+	m.mu.Lock()
+	e := m.byStation(o.Station)
+	isNew := e == nil
+	if isNew {
+		e = &entry{Emergency: &firebase.Emergency{
+			ID:         fmt.Sprintf("%s:%d", o.Station, o.Time.Unix()),
+			Station:    o.Station,
+			PacketID:   o.PacketID,
+			Reason:     reason,
+			Message:    o.Message,
+			DetectedAt: o.Time,
+		}}
+		m.active[e.ID] = e
+	}
+	if o.Place != "" {
+		e.Place = o.Place
+	}
+	e.LastPacketID = o.PacketID
+	e.LastMessage = o.Message
+	e.LastSeenAt = o.Time
+	e.PacketCount += 1
+	e.changes += 1
+	snap, changes := *e.Emergency, e.changes
+	m.mu.Unlock()
+
+	if isNew {
+		m.alert(ctx, snap.ID)
+		return
+	}
+	log.Warnf("EMERGENCY: %s (%s) packet #%d", snap.Station, reason, snap.PacketCount)
+	m.save(ctx, snap, changes)
+}
+
+// Acknowledge stops alerting on an emergency.
+func (m *Manager) Acknowledge(ctx context.Context, id, operator string) error {
+	m.mu.Lock()
+	e, ok := m.active[id]
+	unstored := ok && !e.stored
+	var snap firebase.Emergency
+	var changes int
+	if unstored {
+		snap, changes = *e.Emergency, e.changes
+	}
+	m.mu.Unlock()
+	if unstored {
+		// Store first, so that there is a record to acknowledge.
+		m.save(ctx, snap, changes)
+	}
+
+	if err := m.Firebase.AckEmergency(ctx, id, operator); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, id)
+	log.Warnf("EMERGENCY %s acknowledged by %s", id, operator)
+	return nil
+}
+
+// HandleAck is the admin API handler for POST /emergencies/{id}/ack.
+func (m *Manager) HandleAck(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Operator string `json:"operator"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Operator == "" {
+		http.Error(w, "operator required", http.StatusBadRequest)
+		return
+	}
+	if err := m.Acknowledge(r.Context(), r.PathValue("id"), req.Operator); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleList is the admin API handler for GET /emergencies.
+func (m *Manager) HandleList(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	var es []firebase.Emergency
+	for _, e := range m.active {
+		es = append(es, *e.Emergency)
+	}
+	m.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(es)
+}
+
+// sync reloads unacknowledged emergencies, picking up acknowledgements made
+// directly in firebase and emergencies from before a restart. Emergencies
+// not yet stored are kept.
+func (m *Manager) sync(ctx context.Context) error {
+	es, err := m.Firebase.LoadActiveEmergencies(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	active := make(map[string]*entry)
+	for _, e := range es {
+		cur, ok := m.active[e.ID]
+		if !ok {
+			cur = &entry{Emergency: e}
+		}
+		cur.stored = true
+		active[e.ID] = cur
+	}
+	for id, e := range m.active {
+		if !e.stored {
+			active[id] = e
+		}
+	}
+	m.active = active
+	return nil
+}
+
+func (m *Manager) realert(ctx context.Context) {
+	var due []string
+	m.mu.Lock()
+	for id, e := range m.active {
+		if time.Since(e.LastAlertAt) >= RealertInterval {
+			due = append(due, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, id := range due {
+		m.alert(ctx, id)
+	}
+}
+
+func (m *Manager) Run(ctx context.Context, wg *sync.WaitGroup) {
+	m.active = make(map[string]*entry)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f := func() {
+			m.flush(ctx)
+			err := m.sync(ctx)
+			m.Firebase.SetHealth("emergency", err)
+			if err != nil {
+				log.Errorf("Failed to sync emergencies: %v", err)
+			}
+			m.realert(ctx)
+		}
+		f()
+		t := time.NewTicker(time.Minute)
+		for ctx.Err() == nil {
+			select {
+			case <-t.C:
+				f()
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
@@ -0,0 +1,33 @@
+package emergency
+
+import (
+	"testing"
+
+	"jheidel-aprs/observe"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		o    *observe.Observation
+		want string
+	}{
+		{"ares comment", &observe.Observation{Comment: "ARES Emergency Comms"}, ""},
+		{"uppercase comment", &observe.Observation{Comment: "ARES EMERGENCY COMMS"}, ""},
+		{"help comment", &observe.Observation{Comment: "happy to help, QRV 146.52"}, ""},
+		{"sos comment", &observe.Observation{Comment: "SOS"}, ""},
+		{"message to other station", &observe.Observation{Message: "MAYDAY"}, ""},
+		{"lowercase message", &observe.Observation{Message: "can you help with sos drill", ToGateway: true}, ""},
+		{"sos message", &observe.Observation{Message: "SOS broken leg", ToGateway: true}, `keyword "SOS"`},
+		{"mayday message", &observe.Observation{Message: "MAYDAY MAYDAY", ToGateway: true}, `keyword "MAYDAY"`},
+		{"help email", &observe.Observation{Source: observe.SourceEmail, Message: "Need HELP at camp", ToGateway: true}, `keyword "HELP"`},
+		{"mic-e", &observe.Observation{Comment: "ARES", Emergency: "Mic-E emergency"}, "Mic-E emergency"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.o); got != tt.want {
+				t.Errorf("Detect() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
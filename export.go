@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/export"
+	"jheidel-aprs/firebase"
+)
+
+// parseTime accepts either an RFC 3339 timestamp or a local date.
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// loadExport validates the export parameters and loads the packets.
+func loadExport(ctx context.Context, fb *firebase.Firebase, station, format, from, to string) ([]*firebase.Packet, error) {
+	if _, ok := export.Formats[format]; !ok {
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+	now := time.Now()
+	start, err := parseTime(from, now.Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTime(to, now)
+	if err != nil {
+		return nil, err
+	}
+	pkts, err := fb.LoadPackets(ctx, station, start, end)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Exporting %d packets from %s as %s", len(pkts), station, format)
+	return pkts, nil
+}
+
+// runExport implements the export subcommand.
+func runExport(ctx context.Context, fb *firebase.Firebase, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	station := fs.String("station", "", "Callsign or device address to export")
+	format := fs.String("format", "gpx", "Export format, one of gpx, kml or geojson")
+	from := fs.String("from", "", "Start of the time range (RFC 3339 or YYYY-MM-DD), default one day ago")
+	to := fs.String("to", "", "End of the time range (RFC 3339 or YYYY-MM-DD), default now")
+	out := fs.String("out", "", "Output file, default stdout")
+	fs.Parse(args)
+
+	if *station == "" {
+		return fmt.Errorf("--station is required")
+	}
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	pkts, err := loadExport(ctx, fb, *station, *format, *from, *to)
+	if err != nil {
+		return err
+	}
+	return export.Write(w, *format, *station, pkts)
+}
+
+// exportHandler serves GET /export?station=&format=&from=&to= on the admin
+// API.
+func exportHandler(fb *firebase.Firebase) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		station, format := q.Get("station"), q.Get("format")
+		if format == "" {
+			format = "gpx"
+		}
+		ct, ok := export.Formats[format]
+		if station == "" || !ok {
+			http.Error(w, "station and a valid format are required", http.StatusBadRequest)
+			return
+		}
+		pkts, err := loadExport(r.Context(), fb, station, format, q.Get("from"), q.Get("to"))
+		if err != nil {
+			log.Errorf("Export failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Encode fully before writing, so that errors can still be reported.
+		var buf bytes.Buffer
+		if err := export.Write(&buf, format, station, pkts); err != nil {
+			log.Errorf("Export failed: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ct)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", station+"."+format))
+		w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,191 @@
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"jheidel-aprs/firebase"
+)
+
+var Formats = map[string]string{
+	"gpx":     "application/gpx+xml",
+	"kml":     "application/vnd.google-earth.kml+xml",
+	"geojson": "application/geo+json",
+}
+
+// Write encodes the positions of the packets in the given format. Packets
+// with message text become annotated waypoints.
+func Write(w io.Writer, format, station string, pkts []*firebase.Packet) error {
+	var pos []*firebase.Packet
+	for _, p := range pkts {
+		if p.HasPosition && p.Position != nil {
+			pos = append(pos, p)
+		}
+	}
+	switch format {
+	case "gpx":
+		return writeGPX(w, station, pos)
+	case "kml":
+		return writeKML(w, station, pos)
+	case "geojson":
+		return writeGeoJSON(w, station, pos)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Time string  `xml:"time"`
+	Name string  `xml:"name,omitempty"`
+	Desc string  `xml:"desc,omitempty"`
+}
+
+type gpx struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Version   string     `xml:"version,attr"`
+	Creator   string     `xml:"creator,attr"`
+	Xmlns     string     `xml:"xmlns,attr"`
+	Waypoints []gpxPoint `xml:"wpt"`
+	Track     struct {
+		Name    string `xml:"name"`
+		Segment struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+func writeGPX(w io.Writer, station string, pkts []*firebase.Packet) error {
+	g := &gpx{
+		Version: "1.1",
+		Creator: "jheidel-aprs",
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+	}
+	g.Track.Name = station
+	for _, p := range pkts {
+		pt := gpxPoint{
+			Lat:  p.Position.Latitude,
+			Lon:  p.Position.Longitude,
+			Time: p.ReceivedAt.UTC().Format(time.RFC3339),
+		}
+		g.Track.Segment.Points = append(g.Track.Segment.Points, pt)
+		if p.Message != "" {
+			pt.Name = p.ReceivedAt.Format("Jan 2 3:04 PM")
+			pt.Desc = p.Message
+			g.Waypoints = append(g.Waypoints, pt)
+		}
+	}
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(g)
+}
+
+type kmlPlacemark struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description,omitempty"`
+	TimeStamp   *struct {
+		When string `xml:"when"`
+	} `xml:"TimeStamp,omitempty"`
+	Point *struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"Point,omitempty"`
+	LineString *struct {
+		Tessellate  int    `xml:"tessellate"`
+		Coordinates string `xml:"coordinates"`
+	} `xml:"LineString,omitempty"`
+}
+
+type kml struct {
+	XMLName  xml.Name `xml:"kml"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Document struct {
+		Name       string         `xml:"name"`
+		Placemarks []kmlPlacemark `xml:"Placemark"`
+	} `xml:"Document"`
+}
+
+func writeKML(w io.Writer, station string, pkts []*firebase.Packet) error {
+	k := &kml{Xmlns: "http://www.opengis.net/kml/2.2"}
+	k.Document.Name = station
+
+	track := kmlPlacemark{Name: station}
+	track.LineString = &struct {
+		Tessellate  int    `xml:"tessellate"`
+		Coordinates string `xml:"coordinates"`
+	}{Tessellate: 1}
+	for _, p := range pkts {
+		coord := fmt.Sprintf("%f,%f", p.Position.Longitude, p.Position.Latitude)
+		track.LineString.Coordinates += coord + " "
+		if p.Message == "" {
+			continue
+		}
+		pm := kmlPlacemark{
+			Name:        p.ReceivedAt.Format("Jan 2 3:04 PM"),
+			Description: p.Message,
+		}
+		pm.TimeStamp = &struct {
+			When string `xml:"when"`
+		}{When: p.ReceivedAt.UTC().Format(time.RFC3339)}
+		pm.Point = &struct {
+			Coordinates string `xml:"coordinates"`
+		}{Coordinates: coord}
+		k.Document.Placemarks = append(k.Document.Placemarks, pm)
+	}
+	k.Document.Placemarks = append(k.Document.Placemarks, track)
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(k)
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   map[string]interface{} `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+func writeGeoJSON(w io.Writer, station string, pkts []*firebase.Packet) error {
+	var line [][]float64
+	var times []string
+	var features []*geoJSONFeature
+	for _, p := range pkts {
+		coord := []float64{p.Position.Longitude, p.Position.Latitude}
+		t := p.ReceivedAt.UTC().Format(time.RFC3339)
+		line = append(line, coord)
+		times = append(times, t)
+		if p.Message != "" {
+			features = append(features, &geoJSONFeature{
+				Type: "Feature",
+				Geometry: map[string]interface{}{
+					"type":        "Point",
+					"coordinates": coord,
+				},
+				Properties: map[string]interface{}{
+					"station": station,
+					"time":    t,
+					"message": p.Message,
+				},
+			})
+		}
+	}
+	features = append(features, &geoJSONFeature{
+		Type: "Feature",
+		Geometry: map[string]interface{}{
+			"type":        "LineString",
+			"coordinates": line,
+		},
+		Properties: map[string]interface{}{
+			"station": station,
+			"times":   times,
+		},
+	})
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":     "FeatureCollection",
+		"features": features,
+	})
+}
@@ -0,0 +1,13 @@
+package firebase
+
+import (
+	"context"
+
+	"jheidel-aprs/audit"
+)
+
+// StoreAudit stores a transmission audit entry, keyed by its hash.
+func (f *Firebase) StoreAudit(ctx context.Context, e *audit.Entry) error {
+	_, err := f.client.Collection("audit_log").Doc(e.Hash).Create(ctx, e)
+	return err
+}
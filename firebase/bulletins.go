@@ -0,0 +1,88 @@
+package firebase
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Bulletin is an operator managed bulletin transmitted on a schedule.
+type Bulletin struct {
+	ID string `firestore:"-"`
+
+	// Addressee is BLN0-9 for a general bulletin, or BLNx followed by a
+	// group name for a group bulletin, e.g. BLN1TRAIL.
+	Addressee string `firestore:"addressee"`
+	Text      string `firestore:"text"`
+	// IntervalMinutes is the time between transmissions, if set.
+	IntervalMinutes float64   `firestore:"interval_minutes"`
+	ExpiresAt       time.Time `firestore:"expires_at"`
+
+	LastSentAt time.Time `firestore:"last_sent_at"`
+}
+
+// ReceivedBulletin is the latest bulletin heard from a station for an
+// addressee.
+type ReceivedBulletin struct {
+	Source       string    `firestore:"source"`
+	Addressee    string    `firestore:"addressee"`
+	Text         string    `firestore:"text"`
+	PacketID     string    `firestore:"packet_id"`
+	FirstHeardAt time.Time `firestore:"first_heard_at"`
+	LastHeardAt  time.Time `firestore:"last_heard_at"`
+}
+
+func (f *Firebase) LoadBulletins(ctx context.Context) ([]*Bulletin, error) {
+	iter := f.client.Collection("bulletins").Documents(ctx)
+	defer iter.Stop()
+	var bulletins []*Bulletin
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		b := &Bulletin{}
+		if err := doc.DataTo(b); err != nil {
+			return nil, err
+		}
+		b.ID = doc.Ref.ID
+		bulletins = append(bulletins, b)
+	}
+	return bulletins, nil
+}
+
+// UpdateBulletinSent records when a bulletin was last transmitted, so that
+// redundant gateways share the schedule.
+func (f *Firebase) UpdateBulletinSent(ctx context.Context, id string, t time.Time) error {
+	_, err := f.client.Collection("bulletins").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "last_sent_at", Value: t},
+	})
+	return err
+}
+
+// ReportBulletin stores a received bulletin, replacing any earlier text from
+// the same source and addressee.
+func (f *Firebase) ReportBulletin(ctx context.Context, b *ReceivedBulletin) error {
+	ref := f.client.Collection("received_bulletins").Doc(b.Source + ":" + b.Addressee)
+	updates := []firestore.Update{
+		{Path: "text", Value: b.Text},
+		{Path: "packet_id", Value: b.PacketID},
+		{Path: "last_heard_at", Value: b.LastHeardAt},
+	}
+	_, err := ref.Update(ctx, updates)
+	if status.Code(err) == codes.NotFound {
+		_, err = ref.Create(ctx, b)
+		if status.Code(err) == codes.AlreadyExists {
+			// Raced with another instance, apply the update instead.
+			_, err = ref.Update(ctx, updates)
+		}
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package firebase
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type emailProcessed struct {
+	ProcessedAt time.Time `firestore:"processed_at"`
+}
+
+// EmailProcessed returns whether the email message has already been handled,
+// possibly by a previous run of the gateway.
+func (f *Firebase) EmailProcessed(ctx context.Context, id string) (bool, error) {
+	_, err := f.client.Collection("email_processed").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (f *Firebase) MarkEmailProcessed(ctx context.Context, id string) error {
+	_, err := f.client.Collection("email_processed").Doc(id).Set(ctx, &emailProcessed{
+		ProcessedAt: time.Now(),
+	})
+	return err
+}
+
+// ExpireEmailProcessed deletes processed records older than before,
+// returning the number deleted.
+func (f *Firebase) ExpireEmailProcessed(ctx context.Context, before time.Time) (int, error) {
+	iter := f.client.Collection("email_processed").
+		Where("processed_at", "<", before).
+		Documents(ctx)
+	defer iter.Stop()
+	n := 0
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if _, err := doc.Ref.Delete(ctx); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+type EmailQuarantine struct {
+	ID            string    `firestore:"id"`
+	Class         string    `firestore:"class"`
+	Error         string    `firestore:"error"`
+	Attempts      int       `firestore:"attempts"`
+	QuarantinedAt time.Time `firestore:"quarantined_at"`
+}
+
+// QuarantineEmail records a message which repeatedly failed processing so
+// that it can be inspected by hand.
+func (f *Firebase) QuarantineEmail(ctx context.Context, q *EmailQuarantine) error {
+	_, err := f.client.Collection("email_quarantine").Doc(q.ID).Set(ctx, q)
+	return err
+}
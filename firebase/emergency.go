@@ -0,0 +1,98 @@
+package firebase
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Emergency is a detected distress signal which alerts until acknowledged by
+// an operator. A station has at most one active emergency, which is updated
+// by each further distress packet.
+type Emergency struct {
+	ID         string    `firestore:"-"`
+	Station    string    `firestore:"station"`
+	PacketID   string    `firestore:"packet_id"`
+	Reason     string    `firestore:"reason"`
+	Message    string    `firestore:"message"`
+	Place      string    `firestore:"place"`
+	DetectedAt time.Time `firestore:"detected_at"`
+
+	// Last fields describe the latest distress packet.
+	LastPacketID string    `firestore:"last_packet_id"`
+	LastMessage  string    `firestore:"last_message"`
+	LastSeenAt   time.Time `firestore:"last_seen_at"`
+	PacketCount  int       `firestore:"packet_count"`
+
+	AlertCount  int       `firestore:"alert_count"`
+	LastAlertAt time.Time `firestore:"last_alert_at"`
+
+	Acknowledged   bool      `firestore:"acknowledged"`
+	AcknowledgedBy string    `firestore:"acknowledged_by"`
+	AcknowledgedAt time.Time `firestore:"acknowledged_at"`
+}
+
+// FlagEmergencyPacket marks a stored packet as a distress signal.
+func (f *Firebase) FlagEmergencyPacket(ctx context.Context, packetID, reason string) error {
+	_, err := f.client.Collection("packets").Doc(packetID).Update(ctx, []firestore.Update{
+		{Path: "emergency", Value: true},
+		{Path: "emergency_reason", Value: reason},
+	})
+	return err
+}
+
+// StoreEmergency records a new emergency, or updates the latest packet and
+// alert state of an existing one. Acknowledgement is left untouched.
+func (f *Firebase) StoreEmergency(ctx context.Context, e *Emergency) error {
+	ref := f.client.Collection("emergencies").Doc(e.ID)
+	_, err := ref.Create(ctx, e)
+	if status.Code(err) != codes.AlreadyExists {
+		return err
+	}
+	_, err = ref.Update(ctx, []firestore.Update{
+		{Path: "place", Value: e.Place},
+		{Path: "last_packet_id", Value: e.LastPacketID},
+		{Path: "last_message", Value: e.LastMessage},
+		{Path: "last_seen_at", Value: e.LastSeenAt},
+		{Path: "packet_count", Value: e.PacketCount},
+		{Path: "alert_count", Value: e.AlertCount},
+		{Path: "last_alert_at", Value: e.LastAlertAt},
+	})
+	return err
+}
+
+func (f *Firebase) AckEmergency(ctx context.Context, id, operator string) error {
+	_, err := f.client.Collection("emergencies").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "acknowledged", Value: true},
+		{Path: "acknowledged_by", Value: operator},
+		{Path: "acknowledged_at", Value: time.Now()},
+	})
+	return err
+}
+
+// LoadActiveEmergencies returns all emergencies not yet acknowledged.
+func (f *Firebase) LoadActiveEmergencies(ctx context.Context) ([]*Emergency, error) {
+	iter := f.client.Collection("emergencies").Where("acknowledged", "==", false).Documents(ctx)
+	defer iter.Stop()
+	var es []*Emergency
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		e := &Emergency{}
+		if err := doc.DataTo(e); err != nil {
+			return nil, err
+		}
+		e.ID = doc.Ref.ID
+		es = append(es, e)
+	}
+	return es, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,11 +13,13 @@ import (
 	fb "firebase.google.com/go"
 	"github.com/jheidel/go-aprs"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	"google.golang.org/genproto/googleapis/type/latlng"
 
 	"jheidel-aprs/client"
 	email "jheidel-aprs/email/types"
+	"jheidel-aprs/geo"
 )
 
 const (
@@ -82,35 +86,90 @@ type AprsPacket struct {
 	Comment   string `firestore:"comment"`
 	MessageTo string `firestore:"message_to"`
 
+	SymbolTable string `firestore:"symbol_table"`
+	SymbolCode  string `firestore:"symbol_code"`
+	// Ambiguity is the number of position digits omitted by the sender.
+	Ambiguity int `firestore:"ambiguity"`
+	// PacketTime is the timestamp carried in the packet itself, if any.
+	PacketTime time.Time `firestore:"packet_time"`
+
 	ReplyMessage    string    `firestore:"reply_message"`
 	ReplySentAt     time.Time `firestore:"reply_sent_at"`
 	ReplyLastSentAt time.Time `firestore:"reply_last_sent_at"`
 	ReplyReceived   bool      `firestore:"reply_received"`
 	ReplyReceivedAt time.Time `firestore:"reply_received_at"`
-	ReplyID         int       `firestore:"reply_id"`
+	ReplyID         string    `firestore:"reply_msg_id"`
 	ReplyAttempts   int       `firestore:"reply_attempts"`
+	// LegacyReplyID is the numeric reply ID of packets stored before
+	// alphanumeric message IDs.
+	LegacyReplyID int `firestore:"reply_id,omitempty"`
+	// ReplyStatus is the latest outbox event for the reply, e.g. "acked".
+	ReplyStatus string `firestore:"reply_status"`
+	// ReplySchedule is the time of each scheduled reply attempt.
+	ReplySchedule []time.Time `firestore:"reply_schedule"`
+
+	// Relay fields track delivery of a relayed message to a device.
+	RelayMethod      string    `firestore:"relay_method"`
+	RelayMessage     string    `firestore:"relay_message"`
+	RelaySentAt      time.Time `firestore:"relay_sent_at"`
+	RelayLastSentAt  time.Time `firestore:"relay_last_sent_at"`
+	RelayDelivered   bool      `firestore:"relay_delivered"`
+	RelayDeliveredAt time.Time `firestore:"relay_delivered_at"`
+	RelayAttempts    int       `firestore:"relay_attempts"`
+	RelayError       string    `firestore:"relay_error"`
 }
 
 type EmailPacket struct {
-	Raw string `firestore:"raw"`
+	Raw      string `firestore:"raw"`
+	From     string `firestore:"from"`
+	ReplyURL string `firestore:"reply_url"`
+
+	ReplyMethod      string    `firestore:"reply_method"`
+	ReplyMessage     string    `firestore:"reply_message"`
+	ReplySentAt      time.Time `firestore:"reply_sent_at"`
+	ReplyLastSentAt  time.Time `firestore:"reply_last_sent_at"`
+	ReplyDelivered   bool      `firestore:"reply_delivered"`
+	ReplyDeliveredAt time.Time `firestore:"reply_delivered_at"`
+	ReplyAttempts    int       `firestore:"reply_attempts"`
+	ReplyError       string    `firestore:"reply_error"`
 }
 
 type Packet struct {
 	Hostname   string    `firestore:"hostname"`
 	ReceivedAt time.Time `firestore:"received_at"`
+	Station    string    `firestore:"station"`
 
 	Message     string         `firestore:"message"`
 	HasPosition bool           `firestore:"has_position"`
 	Position    *latlng.LatLng `firestore:"position"`
+	Maidenhead  string         `firestore:"maidenhead"`
+	Place       string         `firestore:"place"`
+
+	HasCourse   bool    `firestore:"has_course"`
+	Course      float64 `firestore:"course"` // degrees
+	Speed       float64 `firestore:"speed"`  // km/h
+	HasAltitude bool    `firestore:"has_altitude"`
+	Altitude    float64 `firestore:"altitude"` // meters
 
 	Aprs  *AprsPacket  `firestore:"aprs"`
 	Email *EmailPacket `firestore:"email"`
 }
 
+// AprsPacketID returns the document ID of a stored APRS packet.
+func AprsPacketID(p *aprs.Packet) string {
+	return fmt.Sprintf("aprs:%s", p.Hash())
+}
+
+// EmailPacketID returns the document ID of a stored email packet.
+func EmailPacketID(e *email.Email) string {
+	return fmt.Sprintf("email:%s", e.ID)
+}
+
 func (f *Firebase) ReportAprsPacket(ctx context.Context, p *aprs.Packet) error {
 	pkt := &Packet{
 		Hostname:   hostname(),
 		ReceivedAt: time.Now(),
+		Station:    p.Src.String(),
 		Message:    p.Message,
 
 		Aprs: &AprsPacket{
@@ -130,8 +189,27 @@ func (f *Firebase) ReportAprsPacket(ctx context.Context, p *aprs.Packet) error {
 			Latitude:  p.Position.Latitude,
 			Longitude: p.Position.Longitude,
 		}
+		pkt.Maidenhead = geo.Maidenhead(*geo.FromLatLng(pkt.Position), 3)
+		pkt.Aprs.Ambiguity = p.Position.Ambiguity
+	}
+	if p.Symbol[1] != 0 {
+		pkt.Aprs.SymbolTable = string(p.Symbol[0])
+		pkt.Aprs.SymbolCode = string(p.Symbol[1])
 	}
-	id := fmt.Sprintf("aprs:%s", p.Hash())
+	if p.Velocity != nil {
+		pkt.HasCourse = true
+		pkt.Course = p.Velocity.Course
+		pkt.Speed = p.Velocity.Speed * geo.KnotsToKmh
+	}
+	if p.Altitude != 0 {
+		// APRS altitude is reported in feet.
+		pkt.HasAltitude = true
+		pkt.Altitude = p.Altitude * geo.FeetToMeters
+	}
+	if p.Time != nil {
+		pkt.Aprs.PacketTime = *p.Time
+	}
+	id := AprsPacketID(p)
 	// https://godoc.org/cloud.google.com/go/firestore
 	_, err := f.client.Collection("packets").Doc(id).Create(ctx, pkt)
 	return err
@@ -141,31 +219,69 @@ func (f *Firebase) ReportEmail(ctx context.Context, e *email.Email) error {
 	pkt := &Packet{
 		Hostname:   hostname(),
 		ReceivedAt: e.Time,
+		Station:    e.Station(),
 		Message:    e.Message,
 
 		Email: &EmailPacket{
-			Raw: e.FullMessage,
+			Raw:      e.FullMessage,
+			From:     e.From,
+			ReplyURL: e.ReplyURL,
 		},
 	}
 	if e.Position != nil {
 		pkt.HasPosition = true
 		pkt.Position = e.Position
+		pkt.Maidenhead = geo.Maidenhead(*geo.FromLatLng(e.Position), 3)
 	}
-	id := fmt.Sprintf("email:%s", e.ID)
+	id := EmailPacketID(e)
 	_, err := f.client.Collection("packets").Doc(id).Create(ctx, pkt)
 	return err
 }
 
-func (f *Firebase) ReportAprsAck(ctx context.Context, p *aprs.Packet, m *client.Message) error {
-	id := fmt.Sprintf("aprs:%s", p.Hash())
-	_, err := f.client.Collection("packets").Doc(id).Update(ctx, []firestore.Update{
+// ReportAprsAck records the progress of the reply to a packet, given a
+// message snapshot and the latest event.
+func (f *Firebase) ReportAprsAck(ctx context.Context, packetID string, status client.EventKind, m *client.Message) error {
+	_, err := f.client.Collection("packets").Doc(packetID).Update(ctx, []firestore.Update{
+		{Path: "aprs.reply_status", Value: string(status)},
 		{Path: "aprs.reply_message", Value: m.Message},
 		{Path: "aprs.reply_sent_at", Value: m.SentAt},
 		{Path: "aprs.reply_last_sent_at", Value: m.LastSentAt},
 		{Path: "aprs.reply_received", Value: m.Received},
 		{Path: "aprs.reply_received_at", Value: m.ReceivedAt},
-		{Path: "aprs.reply_id", Value: m.ID},
+		{Path: "aprs.reply_msg_id", Value: m.ID},
 		{Path: "aprs.reply_attempts", Value: m.Attempts},
+		{Path: "aprs.reply_schedule", Value: m.Schedule},
+	})
+	return err
+}
+
+func (f *Firebase) ReportEmailReply(ctx context.Context, e *email.Email, r *email.Reply) error {
+	id := EmailPacketID(e)
+	_, err := f.client.Collection("packets").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "email.reply_method", Value: r.Method},
+		{Path: "email.reply_message", Value: r.Message},
+		{Path: "email.reply_sent_at", Value: r.SentAt},
+		{Path: "email.reply_last_sent_at", Value: r.LastSentAt},
+		{Path: "email.reply_delivered", Value: r.Delivered},
+		{Path: "email.reply_delivered_at", Value: r.DeliveredAt},
+		{Path: "email.reply_attempts", Value: r.Attempts},
+		{Path: "email.reply_error", Value: r.Error},
+	})
+	return err
+}
+
+// ReportRelay records delivery of a message relayed from an APRS packet by
+// email, SMS or to an email-originated device.
+func (f *Firebase) ReportRelay(ctx context.Context, packetID string, r *email.Reply) error {
+	_, err := f.client.Collection("packets").Doc(packetID).Update(ctx, []firestore.Update{
+		{Path: "aprs.relay_method", Value: r.Method},
+		{Path: "aprs.relay_message", Value: r.Message},
+		{Path: "aprs.relay_sent_at", Value: r.SentAt},
+		{Path: "aprs.relay_last_sent_at", Value: r.LastSentAt},
+		{Path: "aprs.relay_delivered", Value: r.Delivered},
+		{Path: "aprs.relay_delivered_at", Value: r.DeliveredAt},
+		{Path: "aprs.relay_attempts", Value: r.Attempts},
+		{Path: "aprs.relay_error", Value: r.Error},
 	})
 	return err
 }
@@ -225,3 +341,82 @@ func (f *Firebase) LoadCredentials(ctx context.Context) (*email.Credentials, err
 	doc.DataTo(&creds)
 	return &creds, nil
 }
+
+// LoadPackets returns the stored packets from a station received within the
+// time range, oldest first. APRS packets stored before the station field was
+// added are found by their source callsign; older email packets recorded no
+// sender and cannot be attributed to a station.
+func (f *Firebase) LoadPackets(ctx context.Context, station string, from, to time.Time) ([]*Packet, error) {
+	byID := make(map[string]*Packet)
+	for _, field := range []string{"station", "aprs.src"} {
+		iter := f.client.Collection("packets").
+			Where(field, "==", station).
+			Where("received_at", ">=", from).
+			Where("received_at", "<", to).
+			Documents(ctx)
+		err := func() error {
+			defer iter.Stop()
+			for {
+				doc, err := iter.Next()
+				if err == iterator.Done {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				p := &Packet{}
+				if err := doc.DataTo(p); err != nil {
+					return fmt.Errorf("packet %s: %v", doc.Ref.ID, err)
+				}
+				byID[doc.Ref.ID] = p
+			}
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var pkts []*Packet
+	for _, p := range byID {
+		pkts = append(pkts, p)
+	}
+	sort.Slice(pkts, func(i, j int) bool {
+		return pkts[i].ReceivedAt.Before(pkts[j].ReceivedAt)
+	})
+	return pkts, nil
+}
+
+// LatestEmail returns the most recent email received from a device station,
+// or nil if there is none. Replies to the device are sent in response to it.
+func (f *Firebase) LatestEmail(ctx context.Context, station string) (*email.Email, error) {
+	iter := f.client.Collection("packets").
+		Where("station", "==", station).
+		OrderBy("received_at", firestore.Desc).
+		Limit(20).
+		Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := &Packet{}
+		if err := doc.DataTo(p); err != nil {
+			return nil, err
+		}
+		if p.Email == nil {
+			continue
+		}
+		return &email.Email{
+			ID:          strings.TrimPrefix(doc.Ref.ID, "email:"),
+			From:        p.Email.From,
+			Message:     p.Message,
+			FullMessage: p.Email.Raw,
+			Time:        p.ReceivedAt,
+			Position:    p.Position,
+			ReplyURL:    p.Email.ReplyURL,
+		}, nil
+	}
+}
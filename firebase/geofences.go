@@ -0,0 +1,111 @@
+package firebase
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// Geofence is a named area around which station movement is alerted.
+type Geofence struct {
+	ID   string `firestore:"-"`
+	Name string `firestore:"name"`
+	// Kind is either "circle" or "polygon".
+	Kind         string           `firestore:"kind"`
+	Center       *latlng.LatLng   `firestore:"center"`
+	RadiusMeters float64          `firestore:"radius_meters"`
+	Vertices     []*latlng.LatLng `firestore:"vertices"`
+
+	// MaxDwellMinutes, if set, alerts when a station stays inside longer.
+	MaxDwellMinutes float64 `firestore:"max_dwell_minutes"`
+	// Stations limits the fence to the listed stations, if set.
+	Stations []string `firestore:"stations"`
+	// AlertCallsigns are messaged over APRS on events for this fence.
+	AlertCallsigns []string `firestore:"alert_callsigns"`
+}
+
+type GeofenceEvent struct {
+	Fence   string    `firestore:"fence"`
+	Kind    string    `firestore:"kind"`
+	Station string    `firestore:"station"`
+	Time    time.Time `firestore:"time"`
+}
+
+func (f *Firebase) LoadGeofences(ctx context.Context) ([]*Geofence, error) {
+	iter := f.client.Collection("geofences").Documents(ctx)
+	defer iter.Stop()
+	var fences []*Geofence
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		g := &Geofence{}
+		if err := doc.DataTo(g); err != nil {
+			return nil, err
+		}
+		g.ID = doc.Ref.ID
+		fences = append(fences, g)
+	}
+	return fences, nil
+}
+
+// ReportGeofenceEvent attaches a geofence event to a stored packet.
+func (f *Firebase) ReportGeofenceEvent(ctx context.Context, packetID string, e *GeofenceEvent) error {
+	_, err := f.client.Collection("packets").Doc(packetID).Update(ctx, []firestore.Update{
+		{Path: "geofence_events", Value: firestore.ArrayUnion(e)},
+	})
+	return err
+}
+
+// GeofencePresence records a station inside a fence, so that presence
+// survives a restart without repeating enter events.
+type GeofencePresence struct {
+	Station      string    `firestore:"station"`
+	Fence        string    `firestore:"fence"` // Geofence ID
+	EnteredAt    time.Time `firestore:"entered_at"`
+	PacketID     string    `firestore:"packet_id"`
+	DwellAlerted bool      `firestore:"dwell_alerted"`
+}
+
+func presenceID(station, fence string) string {
+	return strings.ReplaceAll(station, "/", "_") + ":" + fence
+}
+
+func (f *Firebase) LoadGeofencePresence(ctx context.Context) ([]*GeofencePresence, error) {
+	iter := f.client.Collection("geofence_presence").Documents(ctx)
+	defer iter.Stop()
+	var ps []*GeofencePresence
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := &GeofencePresence{}
+		if err := doc.DataTo(p); err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func (f *Firebase) StoreGeofencePresence(ctx context.Context, p *GeofencePresence) error {
+	_, err := f.client.Collection("geofence_presence").Doc(presenceID(p.Station, p.Fence)).Set(ctx, p)
+	return err
+}
+
+func (f *Firebase) DeleteGeofencePresence(ctx context.Context, station, fence string) error {
+	_, err := f.client.Collection("geofence_presence").Doc(presenceID(station, fence)).Delete(ctx)
+	return err
+}
@@ -0,0 +1,48 @@
+package firebase
+
+import (
+	"context"
+
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// AprsObject is an operator managed APRS object or item, e.g. a checkpoint
+// or aid station, beaconed by the gateway.
+type AprsObject struct {
+	ID string `firestore:"-"`
+
+	// Name is up to nine characters, and at least three for items.
+	Name string `firestore:"name"`
+	// Item selects an item rather than an object, for things without a
+	// timestamp such as fixed checkpoints.
+	Item        bool           `firestore:"item"`
+	Position    *latlng.LatLng `firestore:"position"`
+	SymbolTable string         `firestore:"symbol_table"`
+	SymbolCode  string         `firestore:"symbol_code"`
+	Comment     string         `firestore:"comment"`
+	// Killed removes the object from maps.
+	Killed bool `firestore:"killed"`
+}
+
+func (f *Firebase) LoadObjects(ctx context.Context) ([]*AprsObject, error) {
+	iter := f.client.Collection("objects").Documents(ctx)
+	defer iter.Stop()
+	var objects []*AprsObject
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		o := &AprsObject{}
+		if err := doc.DataTo(o); err != nil {
+			return nil, err
+		}
+		o.ID = doc.Ref.ID
+		objects = append(objects, o)
+	}
+	return objects, nil
+}
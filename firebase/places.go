@@ -0,0 +1,44 @@
+package firebase
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// Place is an operator defined named location, e.g. a trailhead.
+type Place struct {
+	Name     string         `firestore:"name"`
+	Position *latlng.LatLng `firestore:"position"`
+}
+
+func (f *Firebase) LoadPlaces(ctx context.Context) ([]*Place, error) {
+	iter := f.client.Collection("places").Documents(ctx)
+	defer iter.Stop()
+	var places []*Place
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := &Place{}
+		if err := doc.DataTo(p); err != nil {
+			return nil, err
+		}
+		places = append(places, p)
+	}
+	return places, nil
+}
+
+// SetPacketPlace attaches a human readable place description to a packet.
+func (f *Firebase) SetPacketPlace(ctx context.Context, packetID, place string) error {
+	_, err := f.client.Collection("packets").Doc(packetID).Update(ctx, []firestore.Update{
+		{Path: "place", Value: place},
+	})
+	return err
+}
@@ -0,0 +1,69 @@
+package firebase
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultPolicyID is the document holding the policy for stations
+	// without their own.
+	DefaultPolicyID = "default"
+)
+
+// ReplyPolicy controls how the gateway replies to a station. The document ID
+// is the station callsign.
+type ReplyPolicy struct {
+	// Mode is one of "never", "messages", "beacons" or "template".
+	Mode string `firestore:"mode"`
+	// IntervalMinutes limits how often beacons are replied to.
+	IntervalMinutes float64 `firestore:"interval_minutes"`
+	// Template is the reply text template for the "template" mode.
+	Template string `firestore:"template"`
+	// Templates selects named reply templates by packet kind ("message",
+	// "position", "other" or "default").
+	Templates map[string]string `firestore:"templates"`
+}
+
+// LoadReplyPolicy returns the reply policy for the station, falling back to
+// the default policy. It returns nil if neither exists.
+func (f *Firebase) LoadReplyPolicy(ctx context.Context, station string) (*ReplyPolicy, error) {
+	for _, id := range []string{station, DefaultPolicyID} {
+		doc, err := f.client.Collection("reply_policies").Doc(id).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := &ReplyPolicy{}
+		if err := doc.DataTo(p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	return nil, nil
+}
+
+type replyTemplate struct {
+	Text string `firestore:"text"`
+}
+
+// LoadReplyTemplate returns the text of a named reply template, or the empty
+// string if there is no such template.
+func (f *Firebase) LoadReplyTemplate(ctx context.Context, name string) (string, error) {
+	doc, err := f.client.Collection("reply_templates").Doc(name).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var t replyTemplate
+	if err := doc.DataTo(&t); err != nil {
+		return "", err
+	}
+	return t.Text, nil
+}
@@ -0,0 +1,55 @@
+package firebase
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type AddressBookEntry struct {
+	Alias string `firestore:"alias"`
+	// Kind is one of "email", "sms" or "device", where a device address is
+	// the station of an email-originated device such as an inReach.
+	Kind    string `firestore:"kind"`
+	Address string `firestore:"address"`
+}
+
+// RelayAllowed returns whether the callsign may use the email and SMS relay.
+// Entries in the allowlist may be either a full callsign with SSID or a base
+// callsign, which permits all SSIDs.
+func (f *Firebase) RelayAllowed(ctx context.Context, callsign string) (bool, error) {
+	keys := []string{callsign}
+	if i := strings.Index(callsign, "-"); i != -1 {
+		keys = append(keys, callsign[:i])
+	}
+	for _, k := range keys {
+		_, err := f.client.Collection("relay_allowlist").Doc(k).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// LookupAddress returns the address book entry for alias, or nil if there is
+// no such entry.
+func (f *Firebase) LookupAddress(ctx context.Context, alias string) (*AddressBookEntry, error) {
+	doc, err := f.client.Collection("address_book").Doc(strings.ToLower(alias)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var e AddressBookEntry
+	if err := doc.DataTo(&e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
@@ -0,0 +1,89 @@
+package firebase
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/genproto/googleapis/type/latlng"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Station is the registry entry of a station heard by the gateway. The
+// document ID is the callsign or device address.
+type Station struct {
+	ID     string `firestore:"-"`
+	Source string `firestore:"source"`
+
+	FirstHeardAt time.Time `firestore:"first_heard_at"`
+	LastHeardAt  time.Time `firestore:"last_heard_at"`
+	PacketCount  int       `firestore:"packet_count"`
+
+	LastPosition   *latlng.LatLng `firestore:"last_position"`
+	LastPositionAt time.Time      `firestore:"last_position_at"`
+	LastPlace      string         `firestore:"last_place"`
+	LastMessage    string         `firestore:"last_message"`
+	LastMessageAt  time.Time      `firestore:"last_message_at"`
+
+	LastPath  []string `firestore:"last_path"`
+	Igates    []string `firestore:"igates"`
+	ToCall    string   `firestore:"tocall"`
+	Equipment string   `firestore:"equipment"`
+
+	// Profile set by operators.
+	DisplayName string `firestore:"display_name"`
+	Owner       string `firestore:"owner"`
+	Notes       string `firestore:"notes"`
+	// Timezone is the IANA zone used for times in replies to the station.
+	Timezone string `firestore:"timezone"`
+}
+
+// StationProfile holds the operator editable fields of a station.
+type StationProfile struct {
+	DisplayName string `json:"display_name"`
+	Owner       string `json:"owner"`
+	Notes       string `json:"notes"`
+	Timezone    string `json:"timezone"`
+}
+
+// UpdateStation applies updates to the station registry entry, creating it
+// from the station if it does not exist yet.
+func (f *Firebase) UpdateStation(ctx context.Context, s *Station, updates []firestore.Update) error {
+	ref := f.client.Collection("stations").Doc(s.ID)
+	_, err := ref.Update(ctx, updates)
+	if status.Code(err) == codes.NotFound {
+		_, err = ref.Create(ctx, s)
+		if status.Code(err) == codes.AlreadyExists {
+			// Raced with another instance, apply the update instead.
+			_, err = ref.Update(ctx, updates)
+		}
+	}
+	return err
+}
+
+func (f *Firebase) LoadStation(ctx context.Context, id string) (*Station, error) {
+	doc, err := f.client.Collection("stations").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Station{}
+	if err := doc.DataTo(s); err != nil {
+		return nil, err
+	}
+	s.ID = doc.Ref.ID
+	return s, nil
+}
+
+func (f *Firebase) UpdateStationProfile(ctx context.Context, id string, p *StationProfile) error {
+	_, err := f.client.Collection("stations").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "display_name", Value: p.DisplayName},
+		{Path: "owner", Value: p.Owner},
+		{Path: "notes", Value: p.Notes},
+		{Path: "timezone", Value: p.Timezone},
+	})
+	return err
+}
@@ -0,0 +1,77 @@
+package firebase
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TelemetryReport is a decoded telemetry packet with named, scaled values.
+type TelemetryReport struct {
+	Station  string           `firestore:"station"`
+	PacketID string           `firestore:"packet_id"`
+	Sequence string           `firestore:"sequence"`
+	Time     time.Time        `firestore:"time"`
+	Values   []TelemetryValue `firestore:"values"`
+	Bits     []TelemetryBit   `firestore:"bits"`
+	Project  string           `firestore:"project"`
+}
+
+// TelemetryValue is a named analog channel reading.
+type TelemetryValue struct {
+	Name string  `firestore:"name"`
+	Unit string  `firestore:"unit"`
+	Raw  float64 `firestore:"raw"`
+	// Value is the raw value scaled by the station's equation.
+	Value float64 `firestore:"value"`
+}
+
+// TelemetryBit is a named digital channel reading.
+type TelemetryBit struct {
+	Name   string `firestore:"name"`
+	Unit   string `firestore:"unit"`
+	Raw    bool   `firestore:"raw"`
+	Active bool   `firestore:"active"`
+}
+
+// TelemetryDefinition describes how to interpret a station's telemetry.
+type TelemetryDefinition struct {
+	// Names and Units cover the analog channels, then the digital ones.
+	Names []string `firestore:"names"`
+	Units []string `firestore:"units"`
+	// Coefficients are a, b, c for each analog channel, scaling a raw value
+	// x as a*x^2 + b*x + c.
+	Coefficients []float64 `firestore:"coefficients"`
+	// BitSense holds the state of each digital channel considered active.
+	BitSense []bool `firestore:"bit_sense"`
+	Project  string `firestore:"project"`
+}
+
+func (f *Firebase) ReportTelemetry(ctx context.Context, r *TelemetryReport) error {
+	_, err := f.client.Collection("telemetry").Doc(r.PacketID).Set(ctx, r)
+	return err
+}
+
+// LoadTelemetryDefinition returns the station's telemetry definition, or nil
+// if it has none.
+func (f *Firebase) LoadTelemetryDefinition(ctx context.Context, station string) (*TelemetryDefinition, error) {
+	doc, err := f.client.Collection("telemetry_definitions").Doc(station).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := &TelemetryDefinition{}
+	if err := doc.DataTo(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (f *Firebase) StoreTelemetryDefinition(ctx context.Context, station string, d *TelemetryDefinition) error {
+	_, err := f.client.Collection("telemetry_definitions").Doc(station).Set(ctx, d)
+	return err
+}
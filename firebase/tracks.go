@@ -0,0 +1,101 @@
+package firebase
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+type TrackPoint struct {
+	Position    *latlng.LatLng `firestore:"position"`
+	Time        time.Time      `firestore:"time"`
+	HasAltitude bool           `firestore:"has_altitude"`
+	Altitude    float64        `firestore:"altitude"`
+}
+
+// Track is a trip made by a station, derived from its position reports. The
+// points are stored in a subcollection of the track document, so that long
+// trips do not approach the document size limit.
+type Track struct {
+	Station   string    `firestore:"station"`
+	Source    string    `firestore:"source"`
+	StartedAt time.Time `firestore:"started_at"`
+	EndedAt   time.Time `firestore:"ended_at"`
+
+	Points   []*TrackPoint    `firestore:"-"`
+	Polyline []*latlng.LatLng `firestore:"polyline"`
+
+	DistanceMeters float64 `firestore:"distance_meters"`
+	MovingSeconds  float64 `firestore:"moving_seconds"`
+	AvgSpeed       float64 `firestore:"avg_speed"` // m/s while moving
+	MaxSpeed       float64 `firestore:"max_speed"` // m/s
+	ElevationGain  float64 `firestore:"elevation_gain"`
+}
+
+func (t *Track) ID() string {
+	station := strings.ReplaceAll(t.Station, "/", "_")
+	return fmt.Sprintf("%s:%d", station, t.StartedAt.Unix())
+}
+
+func (f *Firebase) trackRef(t *Track) *firestore.DocumentRef {
+	return f.client.Collection("tracks").Doc(t.ID())
+}
+
+// StoreTrack stores the track summary, excluding its points.
+func (f *Firebase) StoreTrack(ctx context.Context, t *Track) error {
+	_, err := f.trackRef(t).Set(ctx, t)
+	return err
+}
+
+// AddTrackPoint stores a point of the track.
+func (f *Firebase) AddTrackPoint(ctx context.Context, t *Track, p *TrackPoint) error {
+	id := strconv.FormatInt(p.Time.UnixNano(), 10)
+	_, err := f.trackRef(t).Collection("points").Doc(id).Set(ctx, p)
+	return err
+}
+
+// LoadLatestTrack returns the most recent track for the station with its
+// points, or nil if the station has no tracks.
+func (f *Firebase) LoadLatestTrack(ctx context.Context, station string) (*Track, error) {
+	iter := f.client.Collection("tracks").
+		Where("station", "==", station).
+		OrderBy("started_at", firestore.Desc).
+		Limit(1).
+		Documents(ctx)
+	defer iter.Stop()
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var t Track
+	if err := doc.DataTo(&t); err != nil {
+		return nil, err
+	}
+
+	piter := doc.Ref.Collection("points").OrderBy("time", firestore.Asc).Documents(ctx)
+	defer piter.Stop()
+	for {
+		pdoc, err := piter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := &TrackPoint{}
+		if err := pdoc.DataTo(p); err != nil {
+			return nil, err
+		}
+		t.Points = append(t.Points, p)
+	}
+	return &t, nil
+}
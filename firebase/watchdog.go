@@ -0,0 +1,59 @@
+package firebase
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// Watch configures the overdue watchdog for a station. The document ID is
+// the station callsign or device address.
+type Watch struct {
+	Station string `firestore:"-"`
+
+	// IntervalMinutes is the expected time between check-ins, if set.
+	IntervalMinutes float64 `firestore:"interval_minutes"`
+	// ExpectedOutBy is a deadline by which the station should check in, if
+	// set.
+	ExpectedOutBy time.Time `firestore:"expected_out_by"`
+	// EscalateAfterMinutes is the delay between escalation levels once a
+	// station is overdue.
+	EscalateAfterMinutes float64 `firestore:"escalate_after_minutes"`
+	// Contacts are APRS callsigns messaged once an overdue alert escalates.
+	Contacts []string `firestore:"contacts"`
+
+	LastHeardAt time.Time `firestore:"last_heard_at"`
+}
+
+func (f *Firebase) LoadWatches(ctx context.Context) ([]*Watch, error) {
+	iter := f.client.Collection("watchdog").Documents(ctx)
+	defer iter.Stop()
+	var watches []*Watch
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		w := &Watch{}
+		if err := doc.DataTo(w); err != nil {
+			return nil, err
+		}
+		w.Station = doc.Ref.ID
+		watches = append(watches, w)
+	}
+	return watches, nil
+}
+
+// UpdateWatchHeard records when a watched station was last heard, so that
+// timers survive restarts.
+func (f *Firebase) UpdateWatchHeard(ctx context.Context, station string, t time.Time) error {
+	_, err := f.client.Collection("watchdog").Doc(station).Update(ctx, []firestore.Update{
+		{Path: "last_heard_at", Value: t},
+	})
+	return err
+}
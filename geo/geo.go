@@ -0,0 +1,156 @@
+package geo
+
+import (
+	"math"
+
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+const (
+	EarthRadius = 6371008.8 // meters
+)
+
+type Point struct {
+	Lat float64
+	Lon float64
+}
+
+func FromLatLng(l *latlng.LatLng) *Point {
+	if l == nil {
+		return nil
+	}
+	return &Point{Lat: l.Latitude, Lon: l.Longitude}
+}
+
+func (p *Point) LatLng() *latlng.LatLng {
+	return &latlng.LatLng{Latitude: p.Lat, Longitude: p.Lon}
+}
+
+func rad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func deg(r float64) float64 {
+	return r * 180 / math.Pi
+}
+
+// Distance returns the great circle distance between two points in meters.
+func Distance(a, b Point) float64 {
+	dlat := rad(b.Lat - a.Lat)
+	dlon := rad(b.Lon - a.Lon)
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Bearing returns the initial bearing from a to b in degrees from north.
+func Bearing(a, b Point) float64 {
+	y := math.Sin(rad(b.Lon-a.Lon)) * math.Cos(rad(b.Lat))
+	x := math.Cos(rad(a.Lat))*math.Sin(rad(b.Lat)) -
+		math.Sin(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Cos(rad(b.Lon-a.Lon))
+	return math.Mod(deg(math.Atan2(y, x))+360, 360)
+}
+
+// project maps p onto a local plane around the origin, in meters.
+func project(origin, p Point) (float64, float64) {
+	x := rad(p.Lon-origin.Lon) * math.Cos(rad(origin.Lat)) * EarthRadius
+	y := rad(p.Lat-origin.Lat) * EarthRadius
+	return x, y
+}
+
+// segmentDistance returns the distance in meters from p to the segment ab.
+func segmentDistance(p, a, b Point) float64 {
+	bx, by := project(a, b)
+	px, py := project(a, p)
+	l := bx*bx + by*by
+	t := 0.0
+	if l > 0 {
+		t = math.Max(0, math.Min(1, (px*bx+py*by)/l))
+	}
+	dx, dy := px-t*bx, py-t*by
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+// Simplify reduces a polyline with the Douglas-Peucker algorithm, keeping
+// points which deviate more than tolerance meters from the simplified line.
+func Simplify(pts []Point, tolerance float64) []Point {
+	if len(pts) < 3 {
+		return append([]Point(nil), pts...)
+	}
+	keep := make([]bool, len(pts))
+	keep[0], keep[len(pts)-1] = true, true
+
+	var dp func(first, last int)
+	dp = func(first, last int) {
+		max, index := 0.0, -1
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(pts[i], pts[first], pts[last]); d > max {
+				max, index = d, i
+			}
+		}
+		if index != -1 && max > tolerance {
+			keep[index] = true
+			dp(first, index)
+			dp(index, last)
+		}
+	}
+	dp(0, len(pts)-1)
+
+	var out []Point
+	for i, p := range pts {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// InPolygon returns whether p lies inside the polygon, using ray casting.
+func InPolygon(p Point, poly []Point) bool {
+	in := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lon < (b.Lon-a.Lon)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			in = !in
+		}
+	}
+	return in
+}
+
+const (
+	FeetToMeters = 0.3048
+	KnotsToKmh   = 1.852
+)
+
+// Maidenhead returns the Maidenhead grid locator of the point, with the
+// given number of pairs (e.g. 3 for "CN87ts").
+func Maidenhead(p Point, pairs int) string {
+	lon := math.Min(math.Max(p.Lon+180, 0), 360-1e-9)
+	lat := math.Min(math.Max(p.Lat+90, 0), 180-1e-9)
+
+	b := make([]byte, 0, pairs*2)
+	lonStep, latStep := 20.0, 10.0
+	for i := 0; i < pairs; i++ {
+		var base byte
+		var div float64
+		switch {
+		case i == 0:
+			base, div = 'A', 18
+		case i%2 == 1:
+			base, div = '0', 10
+		default:
+			base, div = 'a', 24
+		}
+		if i > 0 {
+			lonStep /= div
+			latStep /= div
+		}
+		lo := int(lon / lonStep)
+		la := int(lat / latStep)
+		b = append(b, base+byte(lo), base+byte(la))
+		lon -= float64(lo) * lonStep
+		lat -= float64(la) * latStep
+	}
+	return string(b)
+}
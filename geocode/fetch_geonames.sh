@@ -0,0 +1,12 @@
+#!/bin/sh
+
+# Downloads the GeoNames extract of places with a population over 15000,
+# which is embedded in the binary. See data/ATTRIBUTION for its license.
+
+set -e
+
+cd "$( dirname "$0" )/data"
+
+curl -fsSLO https://download.geonames.org/export/dump/cities15000.zip
+unzip -o cities15000.zip cities15000.txt
+rm cities15000.zip
@@ -0,0 +1,222 @@
+package geocode
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/geo"
+	"jheidel-aprs/observe"
+)
+
+const (
+	RefreshInterval = 10 * time.Minute
+
+	// Positions closer than this to a place are described as at the place.
+	AtDistance = 200.0 // meters
+)
+
+// GeoNamesExtract is the bundled GeoNames extract, fetched by
+// fetch_geonames.sh before building.
+const GeoNamesExtract = "data/cities15000.txt"
+
+//go:generate ./fetch_geonames.sh
+
+// bundled holds the places used without any gazetteer configured: the
+// GeoNames extract if fetched, and a small hand-curated list of regional
+// towns otherwise.
+//
+//go:embed data
+var bundled embed.FS
+
+type Place struct {
+	Name  string
+	Point geo.Point
+}
+
+// LoadGeoNames parses places from the tab separated GeoNames dump format,
+// e.g. cities15000.txt from https://download.geonames.org/export/dump/.
+func LoadGeoNames(r io.Reader) ([]*Place, error) {
+	var places []*Place
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		cols := strings.Split(s.Text(), "\t")
+		if len(cols) < 6 {
+			continue
+		}
+		lat, err := strconv.ParseFloat(cols[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad latitude %q for %s", cols[4], cols[1])
+		}
+		lon, err := strconv.ParseFloat(cols[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad longitude %q for %s", cols[5], cols[1])
+		}
+		places = append(places, &Place{
+			Name:  cols[1],
+			Point: geo.Point{Lat: lat, Lon: lon},
+		})
+	}
+	return places, s.Err()
+}
+
+// loadBundled parses the bundled GeoNames extract, or if it was not fetched
+// the curated places, which are tab separated name, latitude and longitude
+// lines. Lines starting with # are comments.
+func loadBundled() ([]*Place, error) {
+	if f, err := bundled.Open(GeoNamesExtract); err == nil {
+		defer f.Close()
+		return LoadGeoNames(f)
+	}
+	log.Warnf("GeoNames extract not bundled, run go generate ./geocode; using curated places")
+	b, err := bundled.ReadFile("data/places.tsv")
+	if err != nil {
+		return nil, err
+	}
+	var places []*Place
+	for i, line := range strings.Split(string(b), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if len(cols) != 3 {
+			return nil, fmt.Errorf("line %d: want 3 columns, got %d", i+1, len(cols))
+		}
+		lat, err := strconv.ParseFloat(cols[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad latitude %q", i+1, cols[1])
+		}
+		lon, err := strconv.ParseFloat(cols[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad longitude %q", i+1, cols[2])
+		}
+		places = append(places, &Place{
+			Name:  cols[0],
+			Point: geo.Point{Lat: lat, Lon: lon},
+		})
+	}
+	return places, nil
+}
+
+var compass = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+
+// Geocoder describes positions relative to the nearest known place, using
+// only local data.
+type Geocoder struct {
+	Firebase *firebase.Firebase
+	// Gazetteer replaces the bundled places if set, e.g. from LoadGeoNames.
+	Gazetteer []*Place
+
+	// base are the bundled or gazetteer places.
+	base []*Place
+
+	mu sync.Mutex
+	// all are the named places followed by the base places.
+	all []*Place
+}
+
+// Describe returns a human readable description of the point, such as
+// "3.2 km NE of Mount Si trailhead".
+func (g *Geocoder) Describe(p geo.Point) string {
+	g.mu.Lock()
+	all := g.all
+	g.mu.Unlock()
+
+	var best *Place
+	bestDist := math.Inf(1)
+	for _, pl := range all {
+		if d := geo.Distance(pl.Point, p); d < bestDist {
+			best, bestDist = pl, d
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	if bestDist < AtDistance {
+		return fmt.Sprintf("at %s", best.Name)
+	}
+	dir := compass[int(math.Round(geo.Bearing(best.Point, p)/45))%8]
+	return fmt.Sprintf("%.1f km %s of %s", bestDist/1000, dir, best.Name)
+}
+
+// Observe attaches a place description to the observation and its stored
+// packet. It must run before observers which use the place.
+func (g *Geocoder) Observe(ctx context.Context, o *observe.Observation) {
+	if o.Position == nil {
+		return
+	}
+	o.Place = g.Describe(*o.Position)
+	if o.Place == "" {
+		return
+	}
+	if err := g.Firebase.SetPacketPlace(ctx, o.PacketID, o.Place); err != nil {
+		log.Errorf("Failed to store place for packet %s: %v", o.PacketID, err)
+	}
+}
+
+func (g *Geocoder) refresh(ctx context.Context) error {
+	places, err := g.Firebase.LoadPlaces(ctx)
+	if err != nil {
+		return err
+	}
+	var named []*Place
+	for _, p := range places {
+		if p.Position == nil {
+			continue
+		}
+		named = append(named, &Place{
+			Name:  p.Name,
+			Point: *geo.FromLatLng(p.Position),
+		})
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.all = append(named, g.base...)
+	return nil
+}
+
+func (g *Geocoder) Run(ctx context.Context, wg *sync.WaitGroup) {
+	g.base = g.Gazetteer
+	if g.base == nil {
+		places, err := loadBundled()
+		if err != nil {
+			log.Fatalf("Bundled places are invalid: %v", err)
+		}
+		g.base = places
+	}
+	g.all = g.base
+
+	f := func() {
+		err := g.refresh(ctx)
+		g.Firebase.SetHealth("geocode", err)
+		if err != nil {
+			log.Errorf("Failed to load named places: %v", err)
+		}
+	}
+	// Load synchronously so that early packets are described.
+	f()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(RefreshInterval)
+		for ctx.Err() == nil {
+			select {
+			case <-t.C:
+				f()
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
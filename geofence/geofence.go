@@ -0,0 +1,285 @@
+package geofence
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/geo"
+	"jheidel-aprs/notify"
+	"jheidel-aprs/observe"
+)
+
+const (
+	RefreshInterval = time.Minute
+
+	EventEnter = "enter"
+	EventExit  = "exit"
+	EventDwell = "dwell"
+)
+
+// event is a geofence event awaiting dispatch.
+type event struct {
+	fence *firebase.Geofence
+	kind  string
+	// presence is a snapshot of the station's presence in the fence.
+	presence firebase.GeofencePresence
+	packetID string
+	time     time.Time
+}
+
+// Monitor emits events when stations enter, leave or linger inside the
+// geofences stored in firebase. Events are dispatched in order by a separate
+// goroutine, so that slow notifiers do not hold up packet handling.
+type Monitor struct {
+	Firebase *firebase.Firebase
+	Notifier notify.Notifier
+
+	mu     sync.Mutex
+	fences []*firebase.Geofence
+	// inside maps station, then fence ID, to presence.
+	inside map[string]map[string]*firebase.GeofencePresence
+	loaded bool
+	events chan *event
+}
+
+// Contains returns whether the point lies within the fence.
+func Contains(g *firebase.Geofence, p geo.Point) bool {
+	switch g.Kind {
+	case "circle":
+		if g.Center == nil {
+			return false
+		}
+		return geo.Distance(*geo.FromLatLng(g.Center), p) <= g.RadiusMeters
+	case "polygon":
+		var poly []geo.Point
+		for _, v := range g.Vertices {
+			poly = append(poly, *geo.FromLatLng(v))
+		}
+		return geo.InPolygon(p, poly)
+	}
+	return false
+}
+
+func applies(g *firebase.Geofence, station string) bool {
+	if len(g.Stations) == 0 {
+		return true
+	}
+	for _, s := range g.Stations {
+		if s == station {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch persists presence changes and emits events from the queue.
+func (m *Monitor) dispatch(ctx context.Context, e *event) {
+	var err error
+	switch e.kind {
+	case EventEnter, EventDwell:
+		err = m.Firebase.StoreGeofencePresence(ctx, &e.presence)
+	case EventExit:
+		err = m.Firebase.DeleteGeofencePresence(ctx, e.presence.Station, e.presence.Fence)
+	}
+	if err != nil {
+		log.Errorf("Failed to store geofence presence to firebase: %v", err)
+	}
+	m.emit(ctx, e.fence, e.kind, e.presence.Station, e.packetID, e.time)
+}
+
+// queue appends events for dispatch.
+func (m *Monitor) queue(ctx context.Context, events []*event) {
+	for _, e := range events {
+		select {
+		case m.events <- e:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Monitor) emit(ctx context.Context, g *firebase.Geofence, kind, station, packetID string, t time.Time) {
+	log.Infof("GEOFENCE: %s %s %q", station, kind, g.Name)
+	e := &firebase.GeofenceEvent{
+		Fence:   g.Name,
+		Kind:    kind,
+		Station: station,
+		Time:    t,
+	}
+	if packetID != "" {
+		if err := m.Firebase.ReportGeofenceEvent(ctx, packetID, e); err != nil {
+			log.Errorf("Failed to report geofence event to firebase: %v", err)
+		}
+	}
+
+	var text string
+	switch kind {
+	case EventEnter:
+		text = fmt.Sprintf("%s entered %s", station, g.Name)
+	case EventExit:
+		text = fmt.Sprintf("%s left %s", station, g.Name)
+	case EventDwell:
+		text = fmt.Sprintf("%s in %s over %.0f min", station, g.Name, g.MaxDwellMinutes)
+	}
+	m.Notifier.Notify(ctx, &notify.Notification{
+		Kind:      "geofence_" + kind,
+		Station:   station,
+		PacketID:  packetID,
+		Time:      t,
+		Text:      text,
+		Callsigns: g.AlertCallsigns,
+	})
+}
+
+func (m *Monitor) Observe(ctx context.Context, o *observe.Observation) {
+	if o.Position == nil {
+		return
+	}
+	m.mu.Lock()
+	if !m.loaded {
+		m.mu.Unlock()
+		log.Warnf("Geofence presence not loaded, ignoring position from %s", o.Station)
+		return
+	}
+
+	in, ok := m.inside[o.Station]
+	if !ok {
+		in = make(map[string]*firebase.GeofencePresence)
+		m.inside[o.Station] = in
+	}
+	var events []*event
+	for _, g := range m.fences {
+		if !applies(g, o.Station) {
+			continue
+		}
+		p, was := in[g.ID]
+		is := Contains(g, *o.Position)
+		switch {
+		case is && !was:
+			p = &firebase.GeofencePresence{
+				Station:   o.Station,
+				Fence:     g.ID,
+				EnteredAt: o.Time,
+				PacketID:  o.PacketID,
+			}
+			in[g.ID] = p
+			events = append(events, &event{g, EventEnter, *p, o.PacketID, o.Time})
+		case !is && was:
+			delete(in, g.ID)
+			events = append(events, &event{g, EventExit, *p, o.PacketID, o.Time})
+		case is && was:
+			p.PacketID = o.PacketID
+		}
+	}
+	events = append(events, m.checkDwell(o.Time)...)
+	m.mu.Unlock()
+
+	m.queue(ctx, events)
+}
+
+// checkDwell finds stations which stayed in a fence beyond its limit.
+func (m *Monitor) checkDwell(now time.Time) []*event {
+	var events []*event
+	for _, g := range m.fences {
+		if g.MaxDwellMinutes <= 0 {
+			continue
+		}
+		limit := time.Duration(g.MaxDwellMinutes * float64(time.Minute))
+		for _, in := range m.inside {
+			p, ok := in[g.ID]
+			if !ok || p.DwellAlerted || now.Sub(p.EnteredAt) < limit {
+				continue
+			}
+			p.DwellAlerted = true
+			events = append(events, &event{g, EventDwell, *p, p.PacketID, now})
+		}
+	}
+	return events
+}
+
+// load restores presence stored by a previous run.
+func (m *Monitor) load(ctx context.Context) error {
+	ps, err := m.Firebase.LoadGeofencePresence(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range ps {
+		in, ok := m.inside[p.Station]
+		if !ok {
+			in = make(map[string]*firebase.GeofencePresence)
+			m.inside[p.Station] = in
+		}
+		in[p.Fence] = p
+	}
+	m.loaded = true
+	return nil
+}
+
+func (m *Monitor) refresh(ctx context.Context) error {
+	m.mu.Lock()
+	loaded := m.loaded
+	m.mu.Unlock()
+	if !loaded {
+		if err := m.load(ctx); err != nil {
+			return err
+		}
+	}
+
+	fences, err := m.Firebase.LoadGeofences(ctx)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.fences = fences
+	events := m.checkDwell(time.Now())
+	m.mu.Unlock()
+
+	m.queue(ctx, events)
+	return nil
+}
+
+func (m *Monitor) Run(ctx context.Context, wg *sync.WaitGroup) {
+	m.inside = make(map[string]map[string]*firebase.GeofencePresence)
+	m.events = make(chan *event, 64)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case e := <-m.events:
+				m.dispatch(ctx, e)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		f := func() {
+			err := m.refresh(ctx)
+			m.Firebase.SetHealth("geofence", err)
+			if err != nil {
+				log.Errorf("Failed to refresh geofences: %v", err)
+			}
+		}
+		f()
+		t := time.NewTicker(RefreshInterval)
+		for ctx.Err() == nil {
+			select {
+			case <-t.C:
+				f()
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
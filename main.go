@@ -2,24 +2,55 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"jheidel-aprs/admin"
+	"jheidel-aprs/audit"
+	"jheidel-aprs/bulletin"
 	"jheidel-aprs/client"
 	"jheidel-aprs/email"
+	"jheidel-aprs/emergency"
 	"jheidel-aprs/firebase"
+	"jheidel-aprs/geocode"
+	"jheidel-aprs/geofence"
+	"jheidel-aprs/notify"
+	"jheidel-aprs/objects"
+	"jheidel-aprs/observe"
+	"jheidel-aprs/policy"
+	"jheidel-aprs/relay"
+	"jheidel-aprs/reply"
+	"jheidel-aprs/sms"
+	"jheidel-aprs/stations"
+	"jheidel-aprs/telemetry"
+	"jheidel-aprs/tracking"
+	"jheidel-aprs/watchdog"
 )
 
 var (
 	serverCallsign = flag.String("server_callsign", "KI7QIV-10", "Amateur radio callsign for the aprs server")
 
-	filterCallsign = flag.String("filter_callsign", "p/KI7QIV", "APRS-IS filter to apply")
+	controlOperator = flag.String("control_operator", getEnv("CONTROL_OPERATOR", ""), "Callsign of the licensed control operator, required with --respond")
+	passcode        = flag.Int("passcode", getEnvInt("APRS_PASSCODE", -1), "APRS-IS passcode for server_callsign, transmission is refused unless it matches")
+
+	messageIDPrefix = flag.String("message_id_prefix", getEnv("MESSAGE_ID_PREFIX", ""), "Prefix of outgoing message IDs, unique per gateway instance, random if empty")
+
+	stationIDInterval = flag.Duration("station_id_interval", 10*time.Minute, "Interval between station identification status packets, 0 to disable")
+	stationIDText     = flag.String("station_id_text", "", "Station identification status text, default names the gateway and control operator")
+
+	telemetryInterval = flag.Duration("telemetry_interval", 10*time.Minute, "Interval between gateway telemetry reports, 0 to disable")
+
+	filterCallsign = flag.String("filter_callsign", "p/KI7QIV", "APRS-IS filter to apply, e.g. add g/BLN* to receive bulletins")
 
 	aprsAddr = flag.String("aprs_addr", getEnv("APRS_ADDR", "noam.aprs2.net"), "Address of the APRS-IS server to use")
 	aprsPort = flag.Int("aprs_port", 14580, "Port of the provide aprs_addr APRS-IS server")
@@ -28,13 +59,37 @@ var (
 
 	// WARNING: responses from this server will be transmitted over ham radio
 	// frequencies. Licensed HAM operators only!
-	respond = flag.Bool("respond", false, "Whether to respond to beacon packets")
+	respond = flag.Bool("respond", false, "Global transmit kill switch, replies are sent per station reply policy only when set")
+
+	auditLog = flag.String("audit_log", getEnv("AUDIT_LOG", "/var/lib/jheidel-aprs/audit.jsonl"), "Append-only log of every transmitted packet")
 
 	debug = flag.Bool("debug", false, "Log at debug verbosity")
 
 	credentials = flag.String("credentials", "/etc/jheidel-aprs/key.json", "Location of firebase auth key")
 
-	emailAuth = flag.Bool("email_auth", false, "Run email authorization")
+	emailAuth       = flag.Bool("email_auth", false, "Run email authorization")
+	emailClientFile = flag.String("email_client_file", getEnv("EMAIL_CLIENT_FILE", ""), "OAuth client JSON file for email authorization")
+	emailAuthListen = flag.String("email_auth_listen", "127.0.0.1:0", "Loopback address to receive the email authorization redirect")
+
+	smtpAddr     = flag.String("smtp_addr", getEnv("SMTP_ADDR", ""), "host:port of the SMTP server used for email replies")
+	smtpUser     = flag.String("smtp_user", getEnv("SMTP_USER", ""), "SMTP username")
+	smtpPassword = flag.String("smtp_password", getEnv("SMTP_PASSWORD", ""), "SMTP password")
+	smtpFrom     = flag.String("smtp_from", getEnv("SMTP_FROM", "inreach@jeffheidel.com"), "Sender address for outgoing email")
+
+	defaultTimezone = flag.String("default_timezone", "America/Los_Angeles", "Timezone for reply times to stations without their own")
+
+	gazetteer = flag.String("gazetteer", "", "Optional GeoNames dump file, e.g. cities1000.txt, to use instead of the bundled places")
+
+	adminAddr  = flag.String("admin_addr", "", "Address for the operator admin API, disabled if empty")
+	adminToken = flag.String("admin_token", getEnv("ADMIN_TOKEN", ""), "Bearer token required by the admin API")
+
+	notifyWebhook   = flag.String("notify_webhook", getEnv("NOTIFY_WEBHOOK", ""), "URL which receives JSON alert notifications")
+	notifyCallsigns = flag.String("notify_callsigns", "", "Comma separated APRS callsigns messaged with alert notifications (requires --respond)")
+
+	smsProvider = flag.String("sms_provider", "", "SMS provider for the APRS relay, either twilio or empty to disable SMS relay")
+	twilioSID   = flag.String("twilio_sid", getEnv("TWILIO_SID", ""), "Twilio account SID")
+	twilioToken = flag.String("twilio_token", getEnv("TWILIO_TOKEN", ""), "Twilio auth token")
+	twilioFrom  = flag.String("twilio_from", getEnv("TWILIO_FROM", ""), "Twilio sending phone number")
 
 	buildLabel string
 )
@@ -49,13 +104,29 @@ func getEnv(key, defaultValue string) string {
 func getEnvInt(key string, defaultValue int) int {
 	if v := os.Getenv(key); v != "" {
 		i, err := strconv.Atoi(v)
-		if err != nil {
+		if err == nil {
 			return i
 		}
+		log.Errorf("Ignoring bad %s=%q: %v", key, v, err)
 	}
 	return defaultValue
 }
 
+// clientConfig returns the APRS-IS client configured by flags, which each
+// connection copies.
+func clientConfig(outbox *client.Outbox, alog *audit.Log) *client.Client {
+	return &client.Client{
+		Callsign:      *serverCallsign,
+		Passcode:      *passcode,
+		Filter:        *filterCallsign,
+		ServerAddress: *aprsAddr,
+		ServerPort:    *aprsPort,
+		Outbox:        outbox,
+		BuildLabel:    buildLabel,
+		Audit:         alog,
+	}
+}
+
 func topLevelContext() context.Context {
 	ctx, cancelf := context.WithCancel(context.Background())
 	go func() {
@@ -81,8 +152,28 @@ func main() {
 
 	log.Infof("jheidel-aprs server starting (version %s)", buildLabel)
 
+	if flag.Arg(0) == "audit" {
+		// Works on the local log alone, without firebase credentials.
+		if err := runAudit(flag.Args()[1:]); err != nil {
+			log.Fatalf("Audit failed: %v", err)
+		}
+		log.Exit(0)
+	}
+
+	if err := client.ValidateCallsign(*serverCallsign); err != nil {
+		log.Fatalf("Bad --server_callsign: %v", err)
+	}
 	if *respond {
-		log.Warnf("Responses enabled, will transmit packets!")
+		if *controlOperator == "" {
+			log.Fatalf("--control_operator is required with --respond")
+		}
+		if err := client.ValidateCallsign(*controlOperator); err != nil {
+			log.Fatalf("Bad --control_operator: %v", err)
+		}
+		if err := client.CheckPasscode(*serverCallsign, *passcode); err != nil {
+			log.Fatalf("Refusing to transmit: %v", err)
+		}
+		log.Warnf("Responses enabled, will transmit packets! Control operator %s", *controlOperator)
 	}
 
 	ctx := topLevelContext()
@@ -95,7 +186,9 @@ func main() {
 	fb.BuildLabel = buildLabel
 
 	eauth := &email.Auth{
-		Firebase: fb,
+		Firebase:   fb,
+		ClientFile: *emailClientFile,
+		ListenAddr: *emailAuthListen,
 	}
 
 	if *emailAuth {
@@ -105,26 +198,60 @@ func main() {
 		log.Exit(0)
 	}
 
-	email := &email.Service{
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "export":
+		if err := runExport(ctx, fb, flag.Args()[1:]); err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		log.Exit(0)
+	default:
+		log.Fatalf("Unknown command %q", cmd)
+	}
+
+	mail := &email.Service{
 		Auth:     eauth,
 		Firebase: fb,
 	}
-	email.Run(ctx, wg)
+	mail.Run(ctx, wg)
+
+	smtp := &email.SMTPSender{
+		Addr:     *smtpAddr,
+		Username: *smtpUser,
+		Password: *smtpPassword,
+		From:     *smtpFrom,
+	}
+	replier := &email.Replier{
+		// Prefer the device's own reply mechanism, falling back to SMTP.
+		Senders: []email.Sender{&email.InReachSender{}, smtp},
+	}
 
-	outbox := &client.Outbox{}
+	if err := client.ValidateIDPrefix(*messageIDPrefix); err != nil {
+		log.Fatalf("Bad --message_id_prefix: %v", err)
+	}
+	outbox := &client.Outbox{
+		Governor: &client.Governor{},
+		IDPrefix: *messageIDPrefix,
+	}
 	outbox.Run(ctx, wg)
 
-	single := &client.Client{
-		Callsign:      *serverCallsign,
-		Filter:        *filterCallsign,
-		ServerAddress: *aprsAddr,
-		ServerPort:    *aprsPort,
-		Outbox:        outbox,
-		BuildLabel:    buildLabel,
+	alog := &audit.Log{
+		Path: *auditLog,
+		Sink: fb,
+	}
+	if err := alog.Open(); err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
 	}
+	defer alog.Close()
+
+	single := clientConfig(outbox, alog)
 
 	var conn client.ClientInterface
 	multi := &client.MultiClient{}
+	if *respond {
+		// Ack inbound messages, which is a transmission.
+		multi.Outbox = outbox
+	}
 	// Connect to multiple servers in parallel for increased reliability.
 	for i := 0; i < *aprsChannels; i++ {
 		next := &client.Client{}
@@ -136,14 +263,172 @@ func main() {
 	// Initiate async connection to server(s)
 	conn.Run(ctx, wg)
 
+	if *respond {
+		text := *stationIDText
+		if text == "" {
+			text = fmt.Sprintf("%s APRS gateway, control op %s", client.ClientName, *controlOperator)
+		}
+		id := &client.Identifier{
+			Outbox:   outbox,
+			Text:     text,
+			Interval: *stationIDInterval,
+		}
+		id.Run(ctx, wg)
+
+		bs := &bulletin.Scheduler{
+			Firebase: fb,
+			Outbox:   outbox,
+		}
+		bs.Run(ctx, wg)
+
+		om := &objects.Manager{
+			Firebase: fb,
+			Outbox:   outbox,
+		}
+		om.Run(ctx, wg)
+	}
+
+	var smsp sms.Provider
+	switch *smsProvider {
+	case "":
+		// SMS relay disabled.
+	case "twilio":
+		smsp = &sms.Twilio{
+			AccountSID: *twilioSID,
+			AuthToken:  *twilioToken,
+			From:       *twilioFrom,
+		}
+	default:
+		log.Fatalf("Unknown SMS provider %q", *smsProvider)
+	}
+
+	notifier := notify.Multi{
+		&notify.Webhook{URL: *notifyWebhook},
+	}
+	if *respond {
+		an := &notify.Aprs{Outbox: outbox}
+		for _, call := range strings.Split(*notifyCallsigns, ",") {
+			if call = strings.TrimSpace(call); call != "" {
+				an.Callsigns = append(an.Callsigns, call)
+			}
+		}
+		notifier = append(notifier, an)
+	}
+
+	fences := &geofence.Monitor{
+		Firebase: fb,
+		Notifier: notifier,
+	}
+	fences.Run(ctx, wg)
+
+	wd := &watchdog.Watchdog{
+		Store:    fb,
+		Notifier: notifier,
+	}
+	wd.Run(ctx, wg)
+
+	em := &emergency.Manager{
+		Firebase: fb,
+		Notifier: notifier,
+	}
+	em.Run(ctx, wg)
+
+	api := &admin.Server{
+		Addr:  *adminAddr,
+		Token: *adminToken,
+	}
+	api.HandleFunc("GET /emergencies", em.HandleList)
+	api.HandleFunc("POST /emergencies/{id}/ack", em.HandleAck)
+	api.HandleFunc("GET /export", exportHandler(fb))
+	api.HandleFunc("GET /debug/vars", expvar.Handler().ServeHTTP)
+	api.HandleFunc("GET /outbox", outbox.HandleList)
+	api.HandleFunc("GET /outbox/events", outbox.HandleEvents)
+	api.HandleFunc("GET /outbox/{id}", outbox.HandleGet)
+	api.HandleFunc("DELETE /outbox/{id}", outbox.HandleCancel)
+
+	registry := &stations.Registry{Firebase: fb}
+	api.HandleFunc("GET /stations/{id}", registry.HandleGet)
+	api.HandleFunc("PUT /stations/{id}/profile", registry.HandleProfile)
+	api.Run(ctx, wg)
+
+	gc := &geocode.Geocoder{Firebase: fb}
+	if *gazetteer != "" {
+		f, err := os.Open(*gazetteer)
+		if err != nil {
+			log.Fatalf("Failed to open gazetteer: %v", err)
+		}
+		gc.Gazetteer, err = geocode.LoadGeoNames(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed to load gazetteer: %v", err)
+		}
+	}
+	gc.Run(ctx, wg)
+
+	loc, err := time.LoadLocation(*defaultTimezone)
+	if err != nil {
+		log.Fatalf("Bad default timezone: %v", err)
+	}
+	replies := &reply.Builder{
+		Firebase: fb,
+		Outbox:   outbox,
+		Location: loc,
+	}
+
+	// Subsystems following station activity from every packet source. The
+	// geocoder runs first to describe positions for the others.
+	observers := observe.Observers{
+		gc,
+		registry,
+		&tracking.Tracker{Firebase: fb},
+		fences,
+		wd,
+		em,
+		replies,
+	}
+
+	if *respond {
+		tb := &telemetry.Beacon{
+			Outbox:      outbox,
+			Connections: multi,
+			Callsign:    *serverCallsign,
+			Interval:    *telemetryInterval,
+		}
+		tb.Run(ctx, wg)
+		observers = append(observers, tb)
+	}
+
+	// Shared so that beacon reply intervals apply across packet sources.
+	decider := &policy.Decider{Firebase: fb}
+
 	ah := &AprsHandler{
 		Client:   conn,
 		Outbox:   outbox,
 		Firebase: fb,
+		Relay: &relay.Relay{
+			Store:   fb,
+			SMTP:    smtp,
+			SMS:     smsp,
+			Replier: replier,
+		},
+		Observer: observers,
+		Policy:   decider,
+		Replies:  replies,
+		Telemetry: &telemetry.Recorder{
+			Store: fb,
+		},
 	}
 	ah.Run(ctx, wg)
 
-	// TODO implement email handler
+	eh := &EmailHandler{
+		Service:  mail,
+		Replier:  replier,
+		Firebase: fb,
+		Observer: observers,
+		Policy:   decider,
+		Replies:  replies,
+	}
+	eh.Run(ctx, wg)
 
 	wg.Wait()
 	log.Infof("jheidel-aprs shutdown")
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGetEnvInt(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+	}{
+		{"unset", "", -1},
+		{"valid", "12345", 12345},
+		{"negative", "-1", -1},
+		{"bad", "12x45", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_ENV_INT", tt.value)
+			if got := getEnvInt("TEST_ENV_INT", -1); got != tt.want {
+				t.Errorf("getEnvInt(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasscodeFromEnv(t *testing.T) {
+	t.Setenv("APRS_PASSCODE", "12345")
+	old := *passcode
+	defer func() { *passcode = old }()
+	// Flag defaults are read from the environment at startup.
+	*passcode = getEnvInt("APRS_PASSCODE", -1)
+
+	if got := clientConfig(nil, nil).Passcode; got != 12345 {
+		t.Errorf("client passcode = %d, want 12345 from APRS_PASSCODE", got)
+	}
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jheidel/go-aprs"
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/client"
+)
+
+const (
+	// WebhookTimeout bounds each webhook request when no client is given.
+	WebhookTimeout = 10 * time.Second
+)
+
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	if p == PriorityHigh {
+		return "high"
+	}
+	return "normal"
+}
+
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// Notification is an alert about station activity.
+type Notification struct {
+	Kind     string    `json:"kind"`
+	Priority Priority  `json:"priority"`
+	Station  string    `json:"station"`
+	PacketID string    `json:"packet_id,omitempty"`
+	Time     time.Time `json:"time"`
+	// Text is a short human readable summary, brief enough for an APRS
+	// message.
+	Text string `json:"text"`
+
+	// Callsigns are additional APRS stations to message about this
+	// notification.
+	Callsigns []string `json:"-"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// Multi delivers notifications to every notifier, returning the last error.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, n *Notification) error {
+	var err error
+	for _, nr := range m {
+		if nerr := nr.Notify(ctx, n); nerr != nil {
+			log.Errorf("Failed to deliver %s notification: %v", n.Kind, nerr)
+			err = nerr
+		}
+	}
+	return err
+}
+
+// Webhook posts notifications as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+func (w *Webhook) Notify(ctx context.Context, n *Notification) error {
+	if w.URL == "" {
+		return nil
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", w.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: WebhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// Aprs sends notifications as APRS messages.
+type Aprs struct {
+	Outbox *client.Outbox
+	// Callsigns receive every notification.
+	Callsigns []string
+}
+
+func (a *Aprs) Notify(ctx context.Context, n *Notification) error {
+	text := client.Truncate(n.Text)
+	var err error
+	for _, call := range append(append([]string(nil), a.Callsigns...), n.Callsigns...) {
+		addr, aerr := aprs.ParseAddress(call)
+		if aerr != nil {
+			err = fmt.Errorf("bad callsign %q: %v", call, aerr)
+			continue
+		}
+		log.Infof("NOTIFY %s: %s", call, text)
+		if _, serr := a.Outbox.Send(addr, text, client.WithTrigger(n.PacketID), client.WithRule("notify:"+n.Kind), client.ToOperator()); serr != nil {
+			err = fmt.Errorf("message to %s: %v", call, serr)
+		}
+	}
+	return err
+}
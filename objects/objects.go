@@ -0,0 +1,225 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/client"
+	"jheidel-aprs/firebase"
+)
+
+const (
+	CheckInterval   = 5 * time.Second
+	RefreshInterval = time.Minute
+
+	// Beacons start at InitialInterval after a change, doubling up to
+	// MaxInterval.
+	InitialInterval = time.Minute
+	MaxInterval     = 30 * time.Minute
+	// KillBeacons is the number of times a killed object is beaconed
+	// before it is forgotten.
+	KillBeacons = 3
+
+	DefaultSymbolTable = "/"
+	DefaultSymbolCode  = "."
+
+	// MaxCommentLength is the longest comment APRS allows after an object
+	// or item position.
+	MaxCommentLength = 43
+)
+
+// formatLatLng formats a position in APRS uncompressed form with symbol.
+func formatLatLng(lat, lng float64, table, code string) string {
+	hundredths := func(v float64) (int, int) {
+		h := int(math.Round(math.Abs(v) * 60 * 100))
+		return h / 6000, h % 6000
+	}
+	ns, ew := 'N', 'E'
+	if lat < 0 {
+		ns = 'S'
+	}
+	if lng < 0 {
+		ew = 'W'
+	}
+	latD, latM := hundredths(lat)
+	lngD, lngM := hundredths(lng)
+	return fmt.Sprintf("%02d%02d.%02d%c%s%03d%02d.%02d%c%s",
+		latD, latM/100, latM%100, ns, table, lngD, lngM/100, lngM%100, ew, code)
+}
+
+// Validate checks that an object can be transmitted.
+func Validate(o *firebase.AprsObject) error {
+	min := 1
+	if o.Item {
+		min = 3
+	}
+	if len(o.Name) < min || len(o.Name) > 9 {
+		return fmt.Errorf("name %q must be %d-9 characters", o.Name, min)
+	}
+	if o.Position == nil {
+		return fmt.Errorf("object %q has no position", o.Name)
+	}
+	if o.SymbolTable != "" || o.SymbolCode != "" {
+		// The table is primary, alternate or an overlay character.
+		if len(o.SymbolTable) != 1 || !strings.Contains("/\\0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ", o.SymbolTable) {
+			return fmt.Errorf("symbol table %q must be /, \\ or an overlay character", o.SymbolTable)
+		}
+		if len(o.SymbolCode) != 1 || o.SymbolCode[0] < '!' || o.SymbolCode[0] > '~' {
+			return fmt.Errorf("symbol code %q must be a single printable character", o.SymbolCode)
+		}
+	}
+	if len(o.Comment) > MaxCommentLength {
+		return fmt.Errorf("comment must be at most %d characters, got %d", MaxCommentLength, len(o.Comment))
+	}
+	return nil
+}
+
+// Format returns the information field of an object or item report.
+func Format(o *firebase.AprsObject, now time.Time) string {
+	table, code := o.SymbolTable, o.SymbolCode
+	if table == "" || code == "" {
+		table, code = DefaultSymbolTable, DefaultSymbolCode
+	}
+	pos := formatLatLng(o.Position.GetLatitude(), o.Position.GetLongitude(), table, code)
+	if o.Item {
+		state := "!"
+		if o.Killed {
+			state = "_"
+		}
+		return fmt.Sprintf(")%s%s%s%s", o.Name, state, pos, o.Comment)
+	}
+	state := "*"
+	if o.Killed {
+		state = "_"
+	}
+	return fmt.Sprintf(";%-9s%s%sz%s%s", o.Name, state, now.UTC().Format("021504"), pos, o.Comment)
+}
+
+type object struct {
+	config *firebase.AprsObject
+	// report is the last report text, less timestamp, to detect changes.
+	report   string
+	interval time.Duration
+	next     time.Time
+	kills    int
+}
+
+// Manager beacons objects and items from firebase, on a decaying schedule
+// restarted by every change.
+type Manager struct {
+	Firebase *firebase.Firebase
+	Outbox   *client.Outbox
+
+	objects map[string]*object
+}
+
+// refresh reloads objects, scheduling an immediate beacon of any change.
+// Objects removed from firebase are killed.
+func (m *Manager) refresh(ctx context.Context) error {
+	configs, err := m.Firebase.LoadObjects(ctx)
+	if err != nil {
+		return err
+	}
+	if m.objects == nil {
+		m.objects = make(map[string]*object)
+	}
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, c := range configs {
+		if err := Validate(c); err != nil {
+			log.Errorf("Skipping object %s: %v", c.ID, err)
+			continue
+		}
+		seen[c.ID] = true
+		o, ok := m.objects[c.ID]
+		if !ok {
+			if c.Killed {
+				continue // Never beaconed, nothing to kill.
+			}
+			o = &object{}
+			m.objects[c.ID] = o
+		}
+		o.config = c
+		if report := Format(c, time.Time{}); report != o.report {
+			o.report = report
+			o.interval = InitialInterval
+			o.next = now
+			o.kills = 0
+		}
+	}
+	for id, o := range m.objects {
+		if !seen[id] && !o.config.Killed {
+			log.Infof("Object %s removed, killing", o.config.Name)
+			killed := *o.config
+			killed.Killed = true
+			o.config = &killed
+			o.report = Format(&killed, time.Time{})
+			o.interval = InitialInterval
+			o.next = now
+			o.kills = 0
+		}
+	}
+	return nil
+}
+
+// beacon transmits objects which are due.
+func (m *Manager) beacon() {
+	now := time.Now()
+	for id, o := range m.objects {
+		if now.Before(o.next) {
+			continue
+		}
+		info := Format(o.config, now)
+		log.Infof("OBJECT %s: %s", o.config.Name, info)
+		if err := m.Outbox.Broadcast(info, client.WithRule("object:"+id)); err != nil {
+			log.Warnf("Object %s not sent: %v", o.config.Name, err)
+			o.next = now.Add(client.GovernorInterval)
+			continue
+		}
+		if o.config.Killed {
+			if o.kills += 1; o.kills >= KillBeacons {
+				delete(m.objects, id)
+				continue
+			}
+		}
+		o.next = now.Add(o.interval)
+		if o.interval *= 2; o.interval > MaxInterval {
+			o.interval = MaxInterval
+		}
+	}
+}
+
+func (m *Manager) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		check := time.NewTicker(CheckInterval)
+		defer check.Stop()
+		refresh := time.NewTicker(RefreshInterval)
+		defer refresh.Stop()
+
+		for ctx.Err() == nil {
+			err := m.refresh(ctx)
+			if err != nil {
+				log.Errorf("Failed to refresh objects: %v", err)
+			}
+			m.Firebase.SetHealth("objects", err)
+		beacons:
+			for ctx.Err() == nil {
+				m.beacon()
+				select {
+				case <-check.C:
+				case <-refresh.C:
+					break beacons
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+package objects
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/type/latlng"
+
+	"jheidel-aprs/firebase"
+)
+
+func TestFormat(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	seattle := &latlng.LatLng{Latitude: 47.6062, Longitude: -122.3321}
+	tests := []struct {
+		name string
+		o    *firebase.AprsObject
+		want string
+	}{
+		{
+			"object",
+			&firebase.AprsObject{Name: "SEATTLE", Position: seattle, Comment: "Space Needle"},
+			";SEATTLE  *020304z4736.37N/12219.93W.Space Needle",
+		},
+		{
+			"killed object",
+			&firebase.AprsObject{Name: "SEATTLE", Position: seattle, Killed: true},
+			";SEATTLE  _020304z4736.37N/12219.93W.",
+		},
+		{
+			"item with symbol",
+			&firebase.AprsObject{Name: "AID1", Item: true, Position: seattle, SymbolTable: "\\", SymbolCode: "a"},
+			")AID1!4736.37N\\12219.93Wa",
+		},
+		{
+			"southern hemisphere",
+			&firebase.AprsObject{Name: "SYD", Item: true, Position: &latlng.LatLng{Latitude: -33.8688, Longitude: 151.2093}},
+			")SYD!3352.13S/15112.56E.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.o); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if got := Format(tt.o, now); got != tt.want {
+				t.Errorf("Format = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	pos := &latlng.LatLng{Latitude: 47.6062, Longitude: -122.3321}
+	tests := []struct {
+		name string
+		o    *firebase.AprsObject
+		ok   bool
+	}{
+		{"default symbol", &firebase.AprsObject{Name: "A", Position: pos}, true},
+		{"overlay", &firebase.AprsObject{Name: "A", Position: pos, SymbolTable: "S", SymbolCode: "#"}, true},
+		{"no position", &firebase.AprsObject{Name: "A"}, false},
+		{"long name", &firebase.AprsObject{Name: "TENLETTERS", Position: pos}, false},
+		{"short item", &firebase.AprsObject{Name: "AB", Item: true, Position: pos}, false},
+		{"long table", &firebase.AprsObject{Name: "A", Position: pos, SymbolTable: "//", SymbolCode: "."}, false},
+		{"bad table", &firebase.AprsObject{Name: "A", Position: pos, SymbolTable: "x", SymbolCode: "."}, false},
+		{"long code", &firebase.AprsObject{Name: "A", Position: pos, SymbolTable: "/", SymbolCode: ".."}, false},
+		{"table only", &firebase.AprsObject{Name: "A", Position: pos, SymbolTable: "/"}, false},
+		{"space code", &firebase.AprsObject{Name: "A", Position: pos, SymbolTable: "/", SymbolCode: " "}, false},
+		{"max comment", &firebase.AprsObject{Name: "A", Position: pos, Comment: strings.Repeat("x", MaxCommentLength)}, true},
+		{"long comment", &firebase.AprsObject{Name: "A", Position: pos, Comment: strings.Repeat("x", MaxCommentLength+1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.o); (err == nil) != tt.ok {
+				t.Errorf("Validate = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package observe
+
+import (
+	"context"
+	"time"
+
+	"jheidel-aprs/geo"
+)
+
+const (
+	SourceAprs  = "aprs"
+	SourceEmail = "email"
+)
+
+// Observation is a packet from any source, normalized for the subsystems
+// which follow station activity.
+type Observation struct {
+	Source  string
+	Station string
+	// PacketID is the document ID of the stored packet.
+	PacketID string
+	Time     time.Time
+	Message  string
+	Comment  string
+	// ToGateway is set for messages addressed to the gateway itself.
+	ToGateway bool
+
+	// APRS addressing, empty for other sources.
+	ToCall string
+	Path   []string
+
+	// Emergency is the reason the source flagged this packet as an
+	// emergency, e.g. a Mic-E emergency status.
+	Emergency string
+
+	Position    *geo.Point
+	HasAltitude bool
+	Altitude    float64 // meters
+
+	// Weather is the raw weather report carried by the packet, if any.
+	Weather string
+
+	// Place describes the position relative to a known place. It is set by
+	// the geocoder.
+	Place string
+}
+
+type Observer interface {
+	Observe(ctx context.Context, o *Observation)
+}
+
+// Observers passes each observation to every observer in turn.
+type Observers []Observer
+
+func (os Observers) Observe(ctx context.Context, o *Observation) {
+	for _, ob := range os {
+		ob.Observe(ctx, o)
+	}
+}
@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+)
+
+const (
+	// ModeNever never transmits to the station.
+	ModeNever = "never"
+	// ModeMessages replies only to messages addressed to the gateway.
+	ModeMessages = "messages"
+	// ModeBeacons also replies to beacons, at most once per interval.
+	ModeBeacons = "beacons"
+	// ModeTemplate replies like ModeBeacons, using the policy's own
+	// template.
+	ModeTemplate = "template"
+
+	DefaultBeaconInterval = 30 * time.Minute
+)
+
+var (
+	// Default applies when no policy is stored.
+	Default = &firebase.ReplyPolicy{Mode: ModeMessages}
+)
+
+// Decider applies per-station reply policies.
+type Decider struct {
+	Firebase *firebase.Firebase
+
+	mu sync.Mutex
+	// lastBeaconReply tracks beacon replies by station for rate limiting.
+	lastBeaconReply map[string]time.Time
+}
+
+func interval(p *firebase.ReplyPolicy) time.Duration {
+	if p.IntervalMinutes > 0 {
+		return time.Duration(p.IntervalMinutes * float64(time.Minute))
+	}
+	return DefaultBeaconInterval
+}
+
+// Decide returns whether to reply to a packet from the station, and the
+// policy which applies.
+func (d *Decider) Decide(ctx context.Context, station string, isMessage bool, now time.Time) (bool, *firebase.ReplyPolicy) {
+	p, err := d.Firebase.LoadReplyPolicy(ctx, station)
+	if err != nil {
+		// Fail safe, don't transmit if we can't tell whether we may.
+		log.Errorf("Failed to load reply policy for %s: %v", station, err)
+		return false, nil
+	}
+	if p == nil {
+		p = Default
+	}
+
+	switch p.Mode {
+	case ModeMessages:
+		return isMessage, p
+	case ModeBeacons, ModeTemplate:
+		if isMessage {
+			return true, p
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.lastBeaconReply == nil {
+			d.lastBeaconReply = make(map[string]time.Time)
+		}
+		if last, ok := d.lastBeaconReply[station]; ok && now.Sub(last) < interval(p) {
+			return false, p
+		}
+		d.lastBeaconReply[station] = now
+		return true, p
+	case ModeNever:
+		return false, p
+	}
+	log.Warnf("Unknown reply policy mode %q for %s, not replying", p.Mode, station)
+	return false, p
+}
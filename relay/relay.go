@@ -0,0 +1,196 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/client"
+	"jheidel-aprs/email"
+	"jheidel-aprs/email/types"
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/sms"
+)
+
+var (
+	CommandRE = regexp.MustCompile(`(?i)^\s*(EMAIL|SMS|DEVICE)\s+(\S+)\s+(.+?)\s*$`)
+	PhoneRE   = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+)
+
+// DeliverTimeout bounds a background email or SMS delivery.
+const DeliverTimeout = 2 * time.Minute
+
+// Store provides the relay allowlist and address book, and the device
+// messages to reply to.
+type Store interface {
+	RelayAllowed(ctx context.Context, callsign string) (bool, error)
+	LookupAddress(ctx context.Context, alias string) (*firebase.AddressBookEntry, error)
+	LatestEmail(ctx context.Context, station string) (*types.Email, error)
+	ReportRelay(ctx context.Context, packetID string, r *types.Reply) error
+}
+
+// Relay forwards APRS messages addressed to the gateway onwards by email,
+// SMS or to an email-originated device, e.g. "EMAIL alice@example.com running
+// late".
+type Relay struct {
+	Store Store
+	SMTP  *email.SMTPSender
+	SMS   sms.Provider
+	// Replier delivers to devices through their reply mechanism.
+	Replier *email.Replier
+
+	// wg tracks background deliveries.
+	wg sync.WaitGroup
+}
+
+// IsCommand returns whether the message is a relay request.
+func IsCommand(message string) bool {
+	return CommandRE.MatchString(message)
+}
+
+// resolve determines the delivery kind and address for a target, which is
+// either a literal address or an address book alias.
+func (r *Relay) resolve(ctx context.Context, cmd, target string) (string, string, error) {
+	kind := strings.ToLower(cmd)
+	switch {
+	case kind == "email" && strings.Contains(target, "@"):
+		return kind, target, nil
+	case kind == "sms" && PhoneRE.MatchString(target):
+		return kind, target, nil
+	case kind == "device" && strings.Contains(target, "@"):
+		return kind, strings.ToLower(target), nil
+	}
+	e, err := r.Store.LookupAddress(ctx, target)
+	if err != nil {
+		return "", "", err
+	}
+	if e == nil {
+		return "", "", fmt.Errorf("unknown address %s", target)
+	}
+	if e.Kind != kind {
+		return "", "", fmt.Errorf("%s is not an %s address", target, cmd)
+	}
+	return e.Kind, e.Address, nil
+}
+
+// deliver sends an email or SMS. Mail servers and SMS providers may be slow
+// to respond, so delivery continues in the background, bounded by
+// DeliverTimeout, and is reported against the triggering packet.
+func (r *Relay) deliver(ctx context.Context, packetID, from, kind, addr, text string) error {
+	var send func(ctx context.Context) error
+	switch kind {
+	case "email":
+		if r.SMTP == nil || r.SMTP.Addr == "" {
+			return fmt.Errorf("email relay not configured")
+		}
+		send = func(ctx context.Context) error {
+			return r.SMTP.SendMail(ctx, addr, fmt.Sprintf("APRS message from %s", from), text)
+		}
+	case "sms":
+		if r.SMS == nil {
+			return fmt.Errorf("sms relay not configured")
+		}
+		send = func(ctx context.Context) error {
+			return r.SMS.Send(ctx, addr, fmt.Sprintf("%s: %s", from, text))
+		}
+	default:
+		return fmt.Errorf("unknown relay kind %q", kind)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ctx, cancel := context.WithTimeout(ctx, DeliverTimeout)
+		defer cancel()
+
+		now := time.Now()
+		reply := &types.Reply{
+			Method:     kind,
+			Message:    text,
+			SentAt:     now,
+			LastSentAt: now,
+			Attempts:   1,
+		}
+		if err := send(ctx); err != nil {
+			log.Errorf("Failed to relay %s to %s: %v", kind, addr, err)
+			reply.Error = err.Error()
+		} else {
+			reply.Delivered = true
+			reply.DeliveredAt = time.Now()
+		}
+		if err := r.Store.ReportRelay(ctx, packetID, reply); err != nil {
+			log.Errorf("Failed to report relay delivery to firebase: %v", err)
+		}
+	}()
+	return nil
+}
+
+// deliverDevice replies to the latest email from a device station. Delivery
+// retries for some time, so it continues in the background and is reported
+// against the triggering packet.
+func (r *Relay) deliverDevice(ctx context.Context, packetID, from, station, text string) error {
+	if r.Replier == nil {
+		return fmt.Errorf("device relay not configured")
+	}
+	e, err := r.Store.LatestEmail(ctx, station)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		return fmt.Errorf("no messages from %s", station)
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		reply := r.Replier.Send(ctx, e, fmt.Sprintf("%s: %s", from, text))
+		if !reply.Delivered {
+			log.Errorf("Failed to relay to device %s: %s", station, reply.Error)
+		}
+		if err := r.Store.ReportRelay(ctx, packetID, reply); err != nil {
+			log.Errorf("Failed to report relay delivery to firebase: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Handle relays a command message from the callsign, returning confirmation
+// text suitable for an APRS reply.
+func (r *Relay) Handle(ctx context.Context, packetID, from, message string) string {
+	m := CommandRE.FindStringSubmatch(message)
+	if m == nil {
+		return "Relay: bad command"
+	}
+	cmd, target, text := strings.ToUpper(m[1]), m[2], m[3]
+
+	ok, err := r.Store.RelayAllowed(ctx, from)
+	if err != nil {
+		log.Errorf("Failed to check relay allowlist for %s: %v", from, err)
+		return "Relay unavailable"
+	}
+	if !ok {
+		log.Warnf("Relay request from %s denied, not on allowlist", from)
+		return "Relay denied"
+	}
+
+	kind, addr, err := r.resolve(ctx, cmd, target)
+	if err != nil {
+		return client.Truncate(fmt.Sprintf("Relay failed: %v", err))
+	}
+
+	log.Infof("RELAY %s from %s to %s: %s", kind, from, addr, text)
+	if kind == "device" {
+		err = r.deliverDevice(ctx, packetID, from, addr, text)
+	} else {
+		err = r.deliver(ctx, packetID, from, kind, addr, text)
+	}
+	if err != nil {
+		log.Errorf("Failed to relay %s to %s: %v", kind, addr, err)
+		return client.Truncate(fmt.Sprintf("Relay failed: %v", err))
+	}
+	return client.Truncate(fmt.Sprintf("%s queued to %s", cmd, target))
+}
@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"jheidel-aprs/client"
+	"jheidel-aprs/email/types"
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/sms"
+)
+
+type fakeStore struct {
+	allowed map[string]bool
+	book    map[string]*firebase.AddressBookEntry
+
+	mu      sync.Mutex
+	reports []*types.Reply
+}
+
+func (s *fakeStore) RelayAllowed(ctx context.Context, callsign string) (bool, error) {
+	return s.allowed[callsign], nil
+}
+
+func (s *fakeStore) LookupAddress(ctx context.Context, alias string) (*firebase.AddressBookEntry, error) {
+	return s.book[strings.ToLower(alias)], nil
+}
+
+func (s *fakeStore) LatestEmail(ctx context.Context, station string) (*types.Email, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) ReportRelay(ctx context.Context, packetID string, r *types.Reply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports = append(s.reports, r)
+	return nil
+}
+
+func TestHandle(t *testing.T) {
+	store := &fakeStore{
+		allowed: map[string]bool{"N0CALL-9": true},
+		book: map[string]*firebase.AddressBookEntry{
+			"mom":  {Alias: "mom", Kind: "sms", Address: "+15550001111"},
+			"work": {Alias: "work", Kind: "email", Address: "work@example.com"},
+		},
+	}
+	tests := []struct {
+		name    string
+		from    string
+		message string
+		noSMS   bool
+		want    string
+		wantTo  string
+	}{
+		{"literal", "N0CALL-9", "SMS +15551234567 running late", false, "SMS queued to +15551234567", "+15551234567"},
+		{"alias", "N0CALL-9", "sms mom home soon", false, "SMS queued to mom", "+15550001111"},
+		{"denied", "K1ABC", "SMS mom hello", false, "Relay denied", ""},
+		{"unknown alias", "N0CALL-9", "SMS dad hello", false, "Relay failed: unknown address dad", ""},
+		{"wrong kind", "N0CALL-9", "SMS work hello", false, "Relay failed: work is not an SMS address", ""},
+		{"disabled", "N0CALL-9", "SMS mom hello", true, "Relay failed: sms relay not configured", ""},
+		{"bad command", "N0CALL-9", "hello", false, "Relay: bad command", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &sms.Fake{}
+			r := &Relay{Store: store, SMS: fake}
+			if tt.noSMS {
+				r.SMS = nil
+			}
+			if got := r.Handle(context.Background(), "aprs:1", tt.from, tt.message); got != tt.want {
+				t.Errorf("Handle(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+			r.wg.Wait()
+			sent := fake.Sent()
+			if tt.wantTo == "" {
+				if len(sent) != 0 {
+					t.Errorf("sent %d messages, want none", len(sent))
+				}
+				return
+			}
+			if len(sent) != 1 || sent[0].To != tt.wantTo {
+				t.Fatalf("sent %+v, want one message to %s", sent, tt.wantTo)
+			}
+			if !strings.HasPrefix(sent[0].Text, tt.from+": ") {
+				t.Errorf("sent text %q missing sender prefix", sent[0].Text)
+			}
+		})
+	}
+}
+
+func TestHandleTruncates(t *testing.T) {
+	store := &fakeStore{allowed: map[string]bool{"N0CALL": true}}
+	r := &Relay{Store: store}
+	got := r.Handle(context.Background(), "aprs:1", "N0CALL", "EMAIL "+strings.Repeat("x", 80)+" hello")
+	if len(got) > client.MaxMessageLength {
+		t.Errorf("Handle returned %d characters, want at most %d", len(got), client.MaxMessageLength)
+	}
+}
+
+type blockingSMS struct{}
+
+func (blockingSMS) Send(ctx context.Context, to, text string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHandleDoesNotBlock(t *testing.T) {
+	store := &fakeStore{allowed: map[string]bool{"N0CALL": true}}
+	r := &Relay{Store: store, SMS: blockingSMS{}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if got, want := r.Handle(ctx, "aprs:1", "N0CALL", "SMS +15551234567 hello"), "SMS queued to +15551234567"; got != want {
+		t.Errorf("Handle = %q, want %q", got, want)
+	}
+	// The hung send is reported once it gives up.
+	cancel()
+	r.wg.Wait()
+	if len(store.reports) != 1 || store.reports[0].Delivered || store.reports[0].Error == "" {
+		t.Errorf("reports = %+v, want one failed delivery", store.reports)
+	}
+}
@@ -0,0 +1,204 @@
+package reply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/client"
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/geo"
+	"jheidel-aprs/observe"
+)
+
+const (
+	KindMessage  = "message"
+	KindPosition = "position"
+	KindOther    = "other"
+	KindDefault  = "default"
+)
+
+var (
+	// DefaultTemplates are used when a template name is not found in
+	// firebase.
+	DefaultTemplates = map[string]string{
+		"rx":       `RX {{.Received.Format "3:04 PM"}}`,
+		"position": `RX {{.Received.Format "3:04 PM"}}{{if .Moved}} moved {{printf "%.1f" .DistanceMoved}}km{{end}}{{with .Place}} {{.}}{{end}}`,
+		"pending":  `RX {{.Received.Format "3:04 PM"}}{{if .PendingMessages}} {{.PendingMessages}} pending{{end}}`,
+	}
+
+	// DefaultSelection picks a template name by packet kind when the
+	// station's policy does not.
+	DefaultSelection = map[string]string{
+		KindMessage:  "rx",
+		KindPosition: "position",
+		KindDefault:  "rx",
+	}
+)
+
+// Data is available to reply templates.
+type Data struct {
+	Station string
+	Kind    string
+	Message string
+	// Received is the receive time in the station's timezone.
+	Received time.Time
+
+	Position *geo.Point
+	Grid     string
+	Place    string
+	// Moved reports whether a previous position is known, and
+	// DistanceMoved the km since then.
+	Moved           bool
+	DistanceMoved   float64
+	PendingMessages int
+	// Weather is the last weather report heard from the station.
+	Weather string
+}
+
+type stationState struct {
+	position *geo.Point
+	moved    float64
+	hasMoved bool
+	weather  string
+}
+
+// Kind classifies an observation for template selection.
+func Kind(o *observe.Observation, isMessage bool) string {
+	switch {
+	case isMessage:
+		return KindMessage
+	case o.Position != nil:
+		return KindPosition
+	}
+	return KindOther
+}
+
+// Builder generates reply text from templates. It observes packets to track
+// per-station movement.
+type Builder struct {
+	Firebase *firebase.Firebase
+	Outbox   *client.Outbox
+	// Location is the timezone for stations without their own.
+	Location *time.Location
+
+	mu       sync.Mutex
+	stations map[string]*stationState
+}
+
+func (b *Builder) Observe(ctx context.Context, o *observe.Observation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stations == nil {
+		b.stations = make(map[string]*stationState)
+	}
+	s, ok := b.stations[o.Station]
+	if !ok {
+		s = &stationState{}
+		b.stations[o.Station] = s
+	}
+	if o.Position != nil {
+		if s.position != nil {
+			s.moved = geo.Distance(*s.position, *o.Position) / 1000
+			s.hasMoved = true
+		}
+		s.position = o.Position
+	}
+	if o.Weather != "" {
+		s.weather = o.Weather
+	}
+}
+
+// template returns the template text for the packet kind under the policy.
+func (b *Builder) template(ctx context.Context, pol *firebase.ReplyPolicy, kind string) (string, error) {
+	if pol != nil && pol.Template != "" {
+		return pol.Template, nil
+	}
+	name := ""
+	if pol != nil {
+		if name = pol.Templates[kind]; name == "" {
+			name = pol.Templates[KindDefault]
+		}
+	}
+	if name == "" {
+		if name = DefaultSelection[kind]; name == "" {
+			name = DefaultSelection[KindDefault]
+		}
+	}
+	text, err := b.Firebase.LoadReplyTemplate(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		var ok bool
+		if text, ok = DefaultTemplates[name]; !ok {
+			return "", fmt.Errorf("unknown reply template %q", name)
+		}
+	}
+	return text, nil
+}
+
+func (b *Builder) location(ctx context.Context, station string) *time.Location {
+	loc := b.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	s, err := b.Firebase.LoadStation(ctx, station)
+	if err != nil {
+		log.Warnf("Failed to load station %s for timezone: %v", station, err)
+		return loc
+	}
+	if s == nil || s.Timezone == "" {
+		return loc
+	}
+	l, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		log.Warnf("Bad timezone %q for station %s: %v", s.Timezone, station, err)
+		return loc
+	}
+	return l
+}
+
+// Build generates the reply text for an observed packet.
+func (b *Builder) Build(ctx context.Context, pol *firebase.ReplyPolicy, o *observe.Observation, kind string) (string, error) {
+	text, err := b.template(ctx, pol, kind)
+	if err != nil {
+		return "", err
+	}
+	t, err := template.New("reply").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	d := &Data{
+		Station:  o.Station,
+		Kind:     kind,
+		Message:  o.Message,
+		Received: o.Time.In(b.location(ctx, o.Station)),
+		Position: o.Position,
+		Place:    o.Place,
+	}
+	if o.Position != nil {
+		d.Grid = geo.Maidenhead(*o.Position, 3)
+	}
+	if b.Outbox != nil {
+		d.PendingMessages = b.Outbox.Pending(o.Station)
+	}
+	b.mu.Lock()
+	if s, ok := b.stations[o.Station]; ok {
+		d.Moved, d.DistanceMoved, d.Weather = s.hasMoved, s.moved, s.weather
+	}
+	b.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	return client.Truncate(strings.TrimSpace(buf.String())), nil
+}
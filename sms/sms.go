@@ -0,0 +1,91 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Provider delivers SMS text messages.
+type Provider interface {
+	Send(ctx context.Context, to, text string) error
+}
+
+type Message struct {
+	To     string
+	Text   string
+	SentAt time.Time
+}
+
+// Fake is a local provider for tests, which records messages instead of
+// sending them.
+type Fake struct {
+	mu   sync.Mutex
+	sent []*Message
+}
+
+func (f *Fake) Send(ctx context.Context, to, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	log.Infof("FAKE SMS to %s: %s", to, text)
+	f.sent = append(f.sent, &Message{
+		To:     to,
+		Text:   text,
+		SentAt: time.Now(),
+	})
+	return nil
+}
+
+// Sent returns the messages recorded so far.
+func (f *Fake) Sent() []*Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Message(nil), f.sent...)
+}
+
+// SendTimeout bounds a single send when no Client is configured.
+const SendTimeout = 30 * time.Second
+
+// Twilio sends messages through the Twilio REST API.
+type Twilio struct {
+	AccountSID string
+	AuthToken  string
+	From       string
+
+	Client *http.Client
+}
+
+func (t *Twilio) Send(ctx context.Context, to, text string) error {
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json", t.AccountSID)
+	form := url.Values{
+		"To":   {to},
+		"From": {t.From},
+		"Body": {text},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := t.Client
+	if client == nil {
+		client = &http.Client{Timeout: SendTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("twilio send failed: %s", resp.Status)
+	}
+	return nil
+}
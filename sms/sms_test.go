@@ -0,0 +1,62 @@
+package sms
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestFake(t *testing.T) {
+	f := &Fake{}
+	var p Provider = f
+	if err := p.Send(context.Background(), "+15551234567", "hello"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	sent := f.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("Sent() returned %d messages, want 1", len(sent))
+	}
+	if sent[0].To != "+15551234567" || sent[0].Text != "hello" || sent[0].SentAt.IsZero() {
+		t.Errorf("Sent()[0] = %+v", sent[0])
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestTwilio(t *testing.T) {
+	var form url.Values
+	tw := &Twilio{
+		AccountSID: "AC123",
+		AuthToken:  "secret",
+		From:       "+15550000000",
+		Client: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			if want := "/2010-04-01/Accounts/AC123/Messages.json"; r.URL.Path != want {
+				t.Errorf("request path %q, want %q", r.URL.Path, want)
+			}
+			if u, p, ok := r.BasicAuth(); !ok || u != "AC123" || p != "secret" {
+				t.Errorf("request basic auth %q %q %v", u, p, ok)
+			}
+			r.ParseForm()
+			form = r.PostForm
+			return &http.Response{
+				StatusCode: http.StatusCreated,
+				Status:     "201 Created",
+				Body:       ioutil.NopCloser(strings.NewReader("{}")),
+				Request:    r,
+			}, nil
+		})},
+	}
+	if err := tw.Send(context.Background(), "+15551234567", "hello"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if form.Get("To") != "+15551234567" || form.Get("From") != "+15550000000" || form.Get("Body") != "hello" {
+		t.Errorf("posted form %v", form)
+	}
+}
@@ -0,0 +1,119 @@
+package stations
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/observe"
+)
+
+// Igates returns the igates which relayed a packet, as named after the
+// q construct in its APRS-IS path.
+func Igates(path []string) []string {
+	var igates []string
+	for i, p := range path {
+		if strings.HasPrefix(p, "qA") && i+1 < len(path) {
+			igates = append(igates, path[i+1])
+		}
+	}
+	return igates
+}
+
+// Registry maintains the stations collection from every packet heard.
+type Registry struct {
+	Firebase *firebase.Firebase
+}
+
+func (r *Registry) Observe(ctx context.Context, o *observe.Observation) {
+	s := &firebase.Station{
+		ID:           o.Station,
+		Source:       o.Source,
+		FirstHeardAt: o.Time,
+		LastHeardAt:  o.Time,
+		PacketCount:  1,
+		LastPath:     o.Path,
+		Igates:       Igates(o.Path),
+		ToCall:       o.ToCall,
+		Equipment:    Equipment(o.ToCall),
+	}
+	updates := []firestore.Update{
+		{Path: "source", Value: s.Source},
+		{Path: "last_heard_at", Value: s.LastHeardAt},
+		{Path: "packet_count", Value: firestore.Increment(1)},
+	}
+	if o.Source == observe.SourceAprs {
+		updates = append(updates,
+			firestore.Update{Path: "last_path", Value: s.LastPath},
+			firestore.Update{Path: "tocall", Value: s.ToCall},
+			firestore.Update{Path: "equipment", Value: s.Equipment},
+		)
+		if len(s.Igates) > 0 {
+			var igates []interface{}
+			for _, ig := range s.Igates {
+				igates = append(igates, ig)
+			}
+			updates = append(updates, firestore.Update{Path: "igates", Value: firestore.ArrayUnion(igates...)})
+		}
+	}
+	if o.Position != nil {
+		s.LastPosition = o.Position.LatLng()
+		s.LastPositionAt = o.Time
+		s.LastPlace = o.Place
+		updates = append(updates,
+			firestore.Update{Path: "last_position", Value: s.LastPosition},
+			firestore.Update{Path: "last_position_at", Value: s.LastPositionAt},
+			firestore.Update{Path: "last_place", Value: s.LastPlace},
+		)
+	}
+	if o.Message != "" {
+		s.LastMessage = o.Message
+		s.LastMessageAt = o.Time
+		updates = append(updates,
+			firestore.Update{Path: "last_message", Value: s.LastMessage},
+			firestore.Update{Path: "last_message_at", Value: s.LastMessageAt},
+		)
+	}
+	if err := r.Firebase.UpdateStation(ctx, s, updates); err != nil {
+		log.Errorf("Failed to update station %s: %v", o.Station, err)
+	}
+}
+
+// HandleGet is the admin API handler for GET /stations/{id}.
+func (r *Registry) HandleGet(w http.ResponseWriter, req *http.Request) {
+	s, err := r.Firebase.LoadStation(req.Context(), req.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if s == nil {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// HandleProfile is the admin API handler for PUT /stations/{id}/profile.
+func (r *Registry) HandleProfile(w http.ResponseWriter, req *http.Request) {
+	var p firebase.StationProfile
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := r.Firebase.UpdateStationProfile(req.Context(), req.PathValue("id"), &p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
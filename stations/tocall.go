@@ -0,0 +1,63 @@
+package stations
+
+import (
+	"strings"
+)
+
+// toCalls maps destination address prefixes (TOCALLs) to the equipment or
+// software which uses them. Longer prefixes take precedence.
+var toCalls = map[string]string{
+	"APAGW":  "AGWtracker",
+	"APAT":   "Anytone",
+	"APBPQ":  "BPQ32",
+	"APDI":   "DIXPRS",
+	"APDR":   "APRSdroid",
+	"APDW":   "Dire Wolf",
+	"APFII":  "aprs.fi iOS app",
+	"APGO":   "APRS-Go",
+	"APIN":   "PinPoint APRS",
+	"APJI":   "jAPRSIgate",
+	"APK0":   "Kenwood TH-D7",
+	"APK1":   "Kenwood TM-D700",
+	"APK003": "Kenwood TH-D72",
+	"APK004": "Kenwood TH-D74",
+	"APK005": "Kenwood TH-D75",
+	"APLRG":  "LoRa APRS igate",
+	"APLRT":  "LoRa APRS tracker",
+	"APMG":   "MiniGate",
+	"APMI":   "Microsat",
+	"APN3":   "Kantronics KPC-3",
+	"APOT":   "OpenTracker",
+	"APRX":   "aprx",
+	"APT3":   "TinyTrak3",
+	"APTT":   "TinyTrak",
+	"APU25":  "UI-View32",
+	"APWEE":  "WeeWX",
+	"APWW":   "APRSIS32",
+	"APX":    "Xastir",
+	"APY":    "Yaesu",
+	"APY01D": "Yaesu FT1D",
+	"APY02D": "Yaesu FT2D",
+	"APY03D": "Yaesu FT3D",
+	"APY05D": "Yaesu FT5D",
+	"APY008": "Yaesu VX-8",
+	"APY100": "Yaesu FTM-100D",
+	"APY300": "Yaesu FTM-300D",
+	"APY400": "Yaesu FTM-400",
+	"APZ":    "Experimental",
+}
+
+// Equipment returns the equipment inferred from a TOCALL, or the empty
+// string if unknown.
+func Equipment(tocall string) string {
+	tocall = strings.ToUpper(tocall)
+	if i := strings.Index(tocall, "-"); i != -1 {
+		tocall = tocall[:i]
+	}
+	for n := len(tocall); n >= 3; n-- {
+		if e, ok := toCalls[tocall[:n]]; ok {
+			return e
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/client"
+	"jheidel-aprs/observe"
+)
+
+const (
+	// DefinitionEvery is the number of reports between transmissions of
+	// the telemetry definitions.
+	DefinitionEvery = 6
+
+	// packetScale divides packets per hour to fit the 0-255 analog range,
+	// and is undone by the EQNS definition.
+	packetScale = 10
+)
+
+// Connector reports the number of healthy server connections.
+type Connector interface {
+	Connected() int
+}
+
+// Beacon transmits telemetry about the gateway itself, so that its health
+// can be graphed by APRS sites.
+type Beacon struct {
+	Outbox      *client.Outbox
+	Connections Connector
+	Callsign    string
+	Interval    time.Duration
+
+	packets int64
+	seq     int
+}
+
+// Observe counts packets heard over APRS.
+func (b *Beacon) Observe(ctx context.Context, o *observe.Observation) {
+	if o.Source == observe.SourceAprs {
+		atomic.AddInt64(&b.packets, 1)
+	}
+}
+
+func clamp(v float64) int {
+	return int(math.Max(0, math.Min(255, math.Round(v))))
+}
+
+func (b *Beacon) definitions() []string {
+	return []string{
+		"PARM.Packets,Outbox,Conns",
+		"UNIT.pkt/hr,msgs,conns",
+		// a, b, c for each of the five analog channels.
+		fmt.Sprintf("EQNS.0,%d,0,0,1,0,0,1,0,0,1,0,0,1,0", packetScale),
+		"BITS.00000000,jheidel-aprs gateway",
+	}
+}
+
+// frames returns the information fields of the next report, preceded by
+// the definitions every DefinitionEvery reports.
+func (b *Beacon) frames(perHour float64, outbox, conns int) []string {
+	var frames []string
+	if b.seq%DefinitionEvery == 0 {
+		for _, d := range b.definitions() {
+			frames = append(frames, fmt.Sprintf(":%-9s:%s", b.Callsign, d))
+		}
+	}
+	values := []int{
+		clamp(perHour / packetScale),
+		clamp(float64(outbox)),
+		clamp(float64(conns)),
+	}
+	var fields []string
+	for _, v := range values {
+		fields = append(fields, fmt.Sprintf("%03d", v))
+	}
+	return append(frames, fmt.Sprintf("T#%03d,%s,000,000,00000000", b.seq%1000, strings.Join(fields, ",")))
+}
+
+func (b *Beacon) send() {
+	perHour := float64(atomic.SwapInt64(&b.packets, 0)) * float64(time.Hour) / float64(b.Interval)
+	for _, info := range b.frames(perHour, len(b.Outbox.List()), b.Connections.Connected()) {
+		log.Infof("TELEMETRY: %s", info)
+		if err := b.Outbox.Broadcast(info, client.WithRule("telemetry")); err != nil {
+			log.Warnf("Telemetry not sent: %v", err)
+		}
+	}
+	b.seq++
+}
+
+func (b *Beacon) Run(ctx context.Context, wg *sync.WaitGroup) {
+	if b.Interval <= 0 {
+		log.Infof("Gateway telemetry disabled")
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(b.Interval)
+		defer t.Stop()
+		for ctx.Err() == nil {
+			select {
+			case <-t.C:
+				b.send()
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
@@ -0,0 +1,59 @@
+package telemetry
+
+import (
+	"reflect"
+	"testing"
+
+	"jheidel-aprs/firebase"
+)
+
+func TestBeaconFrames(t *testing.T) {
+	b := &Beacon{Callsign: "KI7QIV-10"}
+	got := b.frames(1234, 2, 1)
+	want := []string{
+		":KI7QIV-10:PARM.Packets,Outbox,Conns",
+		":KI7QIV-10:UNIT.pkt/hr,msgs,conns",
+		":KI7QIV-10:EQNS.0,10,0,0,1,0,0,1,0,0,1,0,0,1,0",
+		":KI7QIV-10:BITS.00000000,jheidel-aprs gateway",
+		"T#000,123,002,001,000,000,00000000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+
+	// Definitions are repeated only every DefinitionEvery reports, and
+	// values are clamped to the analog range.
+	b.seq = 1
+	got = b.frames(99999, 300, 0)
+	want = []string{"T#001,255,255,000,000,000,00000000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+}
+
+func TestBeaconFramesDecode(t *testing.T) {
+	b := &Beacon{Callsign: "KI7QIV"}
+	frames := b.frames(1234, 2, 1)
+
+	def := &firebase.TelemetryDefinition{}
+	for _, f := range frames[:len(frames)-1] {
+		kind, fields, ok := ParseDefinition(f[len(":KI7QIV   :"):])
+		if !ok {
+			t.Fatalf("frame %q is not a definition", f)
+		}
+		if err := Update(def, kind, fields); err != nil {
+			t.Fatalf("Update(%q): %v", f, err)
+		}
+	}
+	if n := len(def.Coefficients); n != 3*AnalogChannels {
+		t.Errorf("EQNS has %d coefficients, want %d", n, 3*AnalogChannels)
+	}
+	data, err := ParseData(frames[len(frames)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := Scale(def, data)
+	if values[0].Name != "Packets" || values[0].Value != 1230 {
+		t.Errorf("first channel = %+v, want 1230 Packets", values[0])
+	}
+}
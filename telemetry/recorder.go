@@ -0,0 +1,123 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jheidel/go-aprs"
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+)
+
+// Store persists station definitions and decoded reports.
+type Store interface {
+	LoadTelemetryDefinition(ctx context.Context, station string) (*firebase.TelemetryDefinition, error)
+	StoreTelemetryDefinition(ctx context.Context, station string, d *firebase.TelemetryDefinition) error
+	ReportTelemetry(ctx context.Context, r *firebase.TelemetryReport) error
+}
+
+// Recorder decodes telemetry reports and definitions heard from stations.
+type Recorder struct {
+	Store Store
+
+	mu          sync.Mutex
+	definitions map[string]*firebase.TelemetryDefinition
+}
+
+// definition returns the station's definition, loading it on first use. The
+// lock is not held while loading.
+func (r *Recorder) definition(ctx context.Context, station string) (*firebase.TelemetryDefinition, error) {
+	r.mu.Lock()
+	if r.definitions == nil {
+		r.definitions = make(map[string]*firebase.TelemetryDefinition)
+	}
+	d, ok := r.definitions[station]
+	r.mu.Unlock()
+	if ok {
+		return d, nil
+	}
+
+	d, err := r.Store.LoadTelemetryDefinition(ctx, station)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		d = &firebase.TelemetryDefinition{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cur, ok := r.definitions[station]; ok {
+		return cur, nil // Loaded or updated concurrently.
+	}
+	r.definitions[station] = d
+	return d, nil
+}
+
+// Handle decodes a packet if it carries telemetry, returning whether it did.
+func (r *Recorder) Handle(ctx context.Context, p *aprs.Packet, packetID string) bool {
+	station := p.Src.String()
+
+	// Definitions are messages a station addresses to itself.
+	if p.MessageTo != nil && p.MessageTo.String() == station {
+		kind, fields, ok := ParseDefinition(p.Message)
+		if !ok {
+			return false
+		}
+		if _, err := r.definition(ctx, station); err != nil {
+			log.Errorf("Failed to load telemetry definition for %s: %v", station, err)
+			return true
+		}
+		r.mu.Lock()
+		// The latest definition, which may have changed while loading.
+		updated := *r.definitions[station]
+		err := Update(&updated, kind, fields)
+		if err == nil {
+			r.definitions[station] = &updated
+		}
+		r.mu.Unlock()
+		if err != nil {
+			log.Warnf("Bad telemetry %s from %s: %v", kind, station, err)
+			return true
+		}
+		log.Infof("TELEMETRY %s definition from %s", kind, station)
+		if err := r.Store.StoreTelemetryDefinition(ctx, station, &updated); err != nil {
+			log.Errorf("Failed to store telemetry definition for %s: %v", station, err)
+		}
+		return true
+	}
+
+	i := strings.Index(p.Raw, ":")
+	if i == -1 || !strings.HasPrefix(p.Raw[i+1:], "T#") {
+		return false
+	}
+	data, err := ParseData(p.Raw[i+1:])
+	if err != nil {
+		log.Warnf("Bad telemetry from %s: %v", station, err)
+		return true
+	}
+	d, err := r.definition(ctx, station)
+	if err != nil {
+		log.Errorf("Failed to load telemetry definition for %s: %v", station, err)
+	}
+	values, bits := Scale(d, data)
+	report := &firebase.TelemetryReport{
+		Station:  station,
+		PacketID: packetID,
+		Sequence: data.Sequence,
+		Time:     time.Now(),
+		Values:   values,
+		Bits:     bits,
+	}
+	if d != nil {
+		report.Project = d.Project
+	}
+	log.Infof("TELEMETRY from %s: %v", station, values)
+	if err := r.Store.ReportTelemetry(ctx, report); err != nil {
+		log.Errorf("Failed to report telemetry from %s: %v", station, err)
+	}
+	return true
+}
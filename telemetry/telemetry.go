@@ -0,0 +1,164 @@
+package telemetry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"jheidel-aprs/firebase"
+)
+
+const (
+	AnalogChannels  = 5
+	DigitalChannels = 8
+)
+
+// Data is a decoded T# telemetry report.
+type Data struct {
+	Sequence string
+	Analog   []float64
+	Bits     []bool
+}
+
+// ParseData decodes a telemetry information field, e.g.
+// "T#005,199,000,255,073,123,01101001". Mic-E encoders send the sequence
+// MIC, which may run straight into the first value as in "T#MIC199,...".
+func ParseData(info string) (*Data, error) {
+	if !strings.HasPrefix(info, "T#") {
+		return nil, fmt.Errorf("not a telemetry report")
+	}
+	body := strings.TrimSpace(info[2:])
+	if strings.HasPrefix(body, "MIC") && !strings.HasPrefix(body, "MIC,") {
+		body = "MIC," + body[3:]
+	}
+	fields := strings.Split(body, ",")
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("telemetry report has no values")
+	}
+	d := &Data{Sequence: fields[0]}
+	for i, f := range fields[1:] {
+		if i == AnalogChannels {
+			// Digital channels follow the analog ones, possibly with a
+			// trailing comment.
+			for j := 0; j < DigitalChannels && j < len(f); j++ {
+				if f[j] != '0' && f[j] != '1' {
+					break
+				}
+				d.Bits = append(d.Bits, f[j] == '1')
+			}
+			break
+		}
+		if f == "" {
+			d.Analog = append(d.Analog, 0)
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad analog value %q: %v", f, err)
+		}
+		d.Analog = append(d.Analog, v)
+	}
+	return d, nil
+}
+
+// Definition kinds, sent by a station as messages addressed to itself.
+const (
+	KindParm = "PARM"
+	KindUnit = "UNIT"
+	KindEqns = "EQNS"
+	KindBits = "BITS"
+)
+
+// ParseDefinition splits a telemetry definition message, e.g.
+// "PARM.Battery,Temp", returning its kind and fields.
+func ParseDefinition(text string) (string, []string, bool) {
+	i := strings.Index(text, ".")
+	if i == -1 {
+		return "", nil, false
+	}
+	switch kind := text[:i]; kind {
+	case KindParm, KindUnit, KindEqns, KindBits:
+		return kind, strings.Split(strings.TrimSpace(text[i+1:]), ","), true
+	}
+	return "", nil, false
+}
+
+// IsDefinition returns whether a message is a telemetry definition.
+func IsDefinition(text string) bool {
+	_, _, ok := ParseDefinition(text)
+	return ok
+}
+
+// Update applies a definition message to the definition.
+func Update(d *firebase.TelemetryDefinition, kind string, fields []string) error {
+	switch kind {
+	case KindParm:
+		d.Names = fields
+	case KindUnit:
+		d.Units = fields
+	case KindEqns:
+		var cs []float64
+		for _, f := range fields {
+			c, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil {
+				return fmt.Errorf("bad coefficient %q: %v", f, err)
+			}
+			cs = append(cs, c)
+		}
+		d.Coefficients = cs
+	case KindBits:
+		if len(fields) == 0 {
+			return fmt.Errorf("empty BITS definition")
+		}
+		d.BitSense = nil
+		for _, c := range fields[0] {
+			d.BitSense = append(d.BitSense, c == '1')
+		}
+		d.Project = strings.Join(fields[1:], ",")
+	default:
+		return fmt.Errorf("unknown definition kind %q", kind)
+	}
+	return nil
+}
+
+func field(s []string, i int) string {
+	if i < len(s) {
+		return s[i]
+	}
+	return ""
+}
+
+// Scale interprets a telemetry report under the definition. A nil definition
+// leaves values unscaled and unnamed.
+func Scale(d *firebase.TelemetryDefinition, data *Data) ([]firebase.TelemetryValue, []firebase.TelemetryBit) {
+	if d == nil {
+		d = &firebase.TelemetryDefinition{}
+	}
+	var values []firebase.TelemetryValue
+	for i, raw := range data.Analog {
+		a, b, c := 0.0, 1.0, 0.0
+		if len(d.Coefficients) >= 3*(i+1) {
+			a, b, c = d.Coefficients[3*i], d.Coefficients[3*i+1], d.Coefficients[3*i+2]
+		}
+		values = append(values, firebase.TelemetryValue{
+			Name:  field(d.Names, i),
+			Unit:  field(d.Units, i),
+			Raw:   raw,
+			Value: a*raw*raw + b*raw + c,
+		})
+	}
+	var bits []firebase.TelemetryBit
+	for i, raw := range data.Bits {
+		sense := true
+		if i < len(d.BitSense) {
+			sense = d.BitSense[i]
+		}
+		bits = append(bits, firebase.TelemetryBit{
+			Name:   field(d.Names, AnalogChannels+i),
+			Unit:   field(d.Units, AnalogChannels+i),
+			Raw:    raw,
+			Active: raw == sense,
+		})
+	}
+	return values, bits
+}
@@ -0,0 +1,147 @@
+package telemetry
+
+import (
+	"reflect"
+	"testing"
+
+	"jheidel-aprs/firebase"
+)
+
+func TestParseData(t *testing.T) {
+	tests := []struct {
+		name string
+		info string
+		want *Data
+	}{
+		{
+			"full",
+			"T#005,199,000,255,073,123,01101001",
+			&Data{Sequence: "005", Analog: []float64{199, 0, 255, 73, 123}, Bits: []bool{false, true, true, false, true, false, false, true}},
+		},
+		{
+			"mic-e",
+			"T#MIC199,000,255,073,123,01101001",
+			&Data{Sequence: "MIC", Analog: []float64{199, 0, 255, 73, 123}, Bits: []bool{false, true, true, false, true, false, false, true}},
+		},
+		{
+			"mic-e with comma",
+			"T#MIC,199,000,255,073,123,01101001",
+			&Data{Sequence: "MIC", Analog: []float64{199, 0, 255, 73, 123}, Bits: []bool{false, true, true, false, true, false, false, true}},
+		},
+		{
+			"short",
+			"T#001,12,34",
+			&Data{Sequence: "001", Analog: []float64{12, 34}},
+		},
+		{
+			"empty and decimal values",
+			"T#002,,1.5,,,",
+			&Data{Sequence: "002", Analog: []float64{0, 1.5, 0, 0, 0}},
+		},
+		{
+			"comment after bits",
+			"T#003,1,2,3,4,5,11110000Solar site",
+			&Data{Sequence: "003", Analog: []float64{1, 2, 3, 4, 5}, Bits: []bool{true, true, true, true, false, false, false, false}},
+		},
+		{
+			"extra fields",
+			"T#004,1,2,3,4,5,10,99,99",
+			&Data{Sequence: "004", Analog: []float64{1, 2, 3, 4, 5}, Bits: []bool{true, false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseData(tt.info)
+			if err != nil {
+				t.Fatalf("ParseData(%q): %v", tt.info, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseData(%q) = %+v, want %+v", tt.info, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDataErrors(t *testing.T) {
+	for _, info := range []string{
+		"!4736.37N/12219.93W.",
+		"T#005",
+		"T#005,abc,000",
+	} {
+		if d, err := ParseData(info); err == nil {
+			t.Errorf("ParseData(%q) = %+v, want error", info, d)
+		}
+	}
+}
+
+func TestParseDefinition(t *testing.T) {
+	tests := []struct {
+		text   string
+		kind   string
+		fields []string
+		ok     bool
+	}{
+		{"PARM.Battery,Temp", KindParm, []string{"Battery", "Temp"}, true},
+		{"UNIT.volts,deg.F", KindUnit, []string{"volts", "deg.F"}, true},
+		{"EQNS.0,0.1,0,0,1,-40", KindEqns, []string{"0", "0.1", "0", "0", "1", "-40"}, true},
+		{"BITS.10000000,Weather station", KindBits, []string{"10000000", "Weather station"}, true},
+		{"PARM.", KindParm, []string{""}, true},
+		{"parm.Battery", "", nil, false},
+		{"Meet at the PARM.", "", nil, false},
+		{"hello", "", nil, false},
+	}
+	for _, tt := range tests {
+		kind, fields, ok := ParseDefinition(tt.text)
+		if kind != tt.kind || !reflect.DeepEqual(fields, tt.fields) || ok != tt.ok {
+			t.Errorf("ParseDefinition(%q) = %q, %q, %v, want %q, %q, %v", tt.text, kind, fields, ok, tt.kind, tt.fields, tt.ok)
+		}
+	}
+}
+
+func TestScale(t *testing.T) {
+	def := &firebase.TelemetryDefinition{}
+	for _, text := range []string{
+		"PARM.Battery,Temp,,,,Door",
+		"UNIT.volts,deg.F,,,,open",
+		"EQNS.0,0.1,0,0,1,-40",
+		"BITS.01000000,Cabin",
+	} {
+		kind, fields, _ := ParseDefinition(text)
+		if err := Update(def, kind, fields); err != nil {
+			t.Fatalf("Update(%q): %v", text, err)
+		}
+	}
+	data, err := ParseData("T#010,128,100,7,,,10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, bits := Scale(def, data)
+	wantValues := []firebase.TelemetryValue{
+		{Name: "Battery", Unit: "volts", Raw: 128, Value: 12.8},
+		{Name: "Temp", Unit: "deg.F", Raw: 100, Value: 60},
+		// Channels without coefficients are unscaled.
+		{Raw: 7, Value: 7},
+		{},
+		{},
+	}
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("values = %+v, want %+v", values, wantValues)
+	}
+	wantBits := []firebase.TelemetryBit{
+		{Name: "Door", Unit: "open", Raw: true, Active: false},
+		{Raw: false, Active: false},
+	}
+	if !reflect.DeepEqual(bits, wantBits) {
+		t.Errorf("bits = %+v, want %+v", bits, wantBits)
+	}
+	if def.Project != "Cabin" {
+		t.Errorf("project = %q, want Cabin", def.Project)
+	}
+
+	// Without a definition values pass through.
+	values, bits = Scale(nil, data)
+	if values[0].Value != 128 || values[0].Name != "" || !bits[0].Active || bits[1].Active {
+		t.Errorf("Scale(nil) = %+v, %+v, want raw values", values, bits)
+	}
+}
@@ -0,0 +1,166 @@
+package tracking
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/geo"
+	"jheidel-aprs/observe"
+)
+
+const (
+	// TripGap is the silence after which a new position starts a new trip.
+	TripGap = 3 * time.Hour
+
+	// Segments slower than this are treated as stationary GPS drift.
+	MovingSpeedMin = 0.3 // m/s
+
+	// Segments faster than this are treated as bad fixes and ignored.
+	SegmentSpeedMax = 150.0 // m/s
+
+	SimplifyTolerance = 15.0 // meters
+)
+
+// Tracker groups station positions into trips and maintains derived
+// statistics for each trip in the tracks collection.
+type Tracker struct {
+	Firebase *firebase.Firebase
+
+	mu     sync.Mutex
+	tracks map[string]*firebase.Track
+}
+
+// current returns the latest known track for the station, loading it from
+// firebase on first use. The lock is not held while loading.
+func (t *Tracker) current(ctx context.Context, station string) (*firebase.Track, error) {
+	t.mu.Lock()
+	if t.tracks == nil {
+		t.tracks = make(map[string]*firebase.Track)
+	}
+	tr, ok := t.tracks[station]
+	t.mu.Unlock()
+	if ok {
+		return tr, nil
+	}
+
+	tr, err := t.Firebase.LoadLatestTrack(ctx, station)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cur, ok := t.tracks[station]; ok {
+		return cur, nil // Loaded concurrently.
+	}
+	t.tracks[station] = tr
+	return tr, nil
+}
+
+func (t *Tracker) Observe(ctx context.Context, o *observe.Observation) {
+	if o.Position == nil {
+		return
+	}
+	if _, err := t.current(ctx, o.Station); err != nil {
+		log.Errorf("Failed to load track for %s: %v", o.Station, err)
+		return
+	}
+
+	t.mu.Lock()
+	tr := t.tracks[o.Station]
+	if tr == nil || o.Time.Sub(tr.EndedAt) > TripGap {
+		tr = &firebase.Track{
+			Station:   o.Station,
+			Source:    o.Source,
+			StartedAt: o.Time,
+		}
+		t.tracks[o.Station] = tr
+		log.Infof("Starting new trip for %s", o.Station)
+	}
+
+	pt := &firebase.TrackPoint{
+		Position:    o.Position.LatLng(),
+		Time:        o.Time,
+		HasAltitude: o.HasAltitude,
+		Altitude:    o.Altitude,
+	}
+	tr.Points = append(tr.Points, pt)
+	if n := len(tr.Points); n > 1 && tr.Points[n-1].Time.Before(tr.Points[n-2].Time) {
+		// Delayed packet, keep points in time order.
+		sort.SliceStable(tr.Points, func(i, j int) bool {
+			return tr.Points[i].Time.Before(tr.Points[j].Time)
+		})
+	}
+	summarize(tr)
+
+	// Store a copy of the summary, as the track may change once unlocked.
+	summary := *tr
+	summary.Points = nil
+	t.mu.Unlock()
+
+	if err := t.Firebase.AddTrackPoint(ctx, &summary, pt); err != nil {
+		log.Errorf("Failed to store track point for %s: %v", o.Station, err)
+	}
+	if err := t.Firebase.StoreTrack(ctx, &summary); err != nil {
+		log.Errorf("Failed to store track for %s: %v", o.Station, err)
+	}
+}
+
+// summarize recomputes the derived statistics of a track from its points.
+func summarize(tr *firebase.Track) {
+	tr.DistanceMeters = 0
+	tr.MovingSeconds = 0
+	tr.MaxSpeed = 0
+	tr.ElevationGain = 0
+
+	var pts []geo.Point
+	var prev *firebase.TrackPoint
+	for _, p := range tr.Points {
+		cur := geo.Point{Lat: p.Position.Latitude, Lon: p.Position.Longitude}
+		if prev == nil {
+			pts = append(pts, cur)
+			prev = p
+			continue
+		}
+		last := geo.Point{Lat: prev.Position.Latitude, Lon: prev.Position.Longitude}
+		d := geo.Distance(last, cur)
+		dt := p.Time.Sub(prev.Time).Seconds()
+		if dt > 0 {
+			speed := d / dt
+			if speed > SegmentSpeedMax {
+				continue // Bad fix, measure from the previous good point.
+			}
+			if speed >= MovingSpeedMin {
+				tr.MovingSeconds += dt
+			}
+			if speed > tr.MaxSpeed {
+				tr.MaxSpeed = speed
+			}
+		}
+		pts = append(pts, cur)
+		tr.DistanceMeters += d
+		if p.HasAltitude && prev.HasAltitude && p.Altitude > prev.Altitude {
+			tr.ElevationGain += p.Altitude - prev.Altitude
+		}
+		prev = p
+	}
+
+	tr.AvgSpeed = 0
+	if tr.MovingSeconds > 0 {
+		tr.AvgSpeed = tr.DistanceMeters / tr.MovingSeconds
+	}
+	if len(tr.Points) > 0 {
+		// StartedAt is left as is since it identifies the track document.
+		tr.EndedAt = tr.Points[len(tr.Points)-1].Time
+	}
+
+	tr.Polyline = nil
+	for _, p := range geo.Simplify(pts, SimplifyTolerance) {
+		tr.Polyline = append(tr.Polyline, p.LatLng())
+	}
+}
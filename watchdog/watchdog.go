@@ -0,0 +1,227 @@
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/notify"
+	"jheidel-aprs/observe"
+)
+
+const (
+	CheckInterval   = 30 * time.Second
+	RefreshInterval = 5 * time.Minute
+
+	DefaultEscalateAfter = 30 * time.Minute
+)
+
+// Clock provides the current time, so that deadlines can be tested.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Store persists watch configuration and last heard times.
+type Store interface {
+	LoadWatches(ctx context.Context) ([]*firebase.Watch, error)
+	UpdateWatchHeard(ctx context.Context, station string, t time.Time) error
+	SetHealth(module string, err error)
+}
+
+type watch struct {
+	config    *firebase.Watch
+	lastHeard time.Time
+	lastPlace string
+	// level is the current escalation level, zero when not overdue.
+	level int
+}
+
+// deadline returns when the station becomes overdue, or zero if it has no
+// applicable deadline.
+func (w *watch) deadline() time.Time {
+	var d time.Time
+	if w.config.IntervalMinutes > 0 && !w.lastHeard.IsZero() {
+		d = w.lastHeard.Add(time.Duration(w.config.IntervalMinutes * float64(time.Minute)))
+	}
+	if out := w.config.ExpectedOutBy; !out.IsZero() && w.lastHeard.Before(out) {
+		if d.IsZero() || out.Before(d) {
+			d = out
+		}
+	}
+	return d
+}
+
+func (w *watch) escalateAfter() time.Duration {
+	if w.config.EscalateAfterMinutes > 0 {
+		return time.Duration(w.config.EscalateAfterMinutes * float64(time.Minute))
+	}
+	return DefaultEscalateAfter
+}
+
+// Watchdog alerts when a watched station misses its expected check-in,
+// escalating the longer it stays quiet.
+type Watchdog struct {
+	Store    Store
+	Notifier notify.Notifier
+	Clock    Clock
+
+	mu      sync.Mutex
+	watches map[string]*watch
+}
+
+func (d *Watchdog) clock() Clock {
+	if d.Clock == nil {
+		return realClock{}
+	}
+	return d.Clock
+}
+
+func (d *Watchdog) Observe(ctx context.Context, o *observe.Observation) {
+	t := o.Time
+	if t.IsZero() {
+		t = d.clock().Now()
+	}
+
+	d.mu.Lock()
+	w, ok := d.watches[o.Station]
+	if !ok || t.Before(w.lastHeard) {
+		// Not watched, or a delayed packet.
+		d.mu.Unlock()
+		return
+	}
+	w.lastHeard = t
+	if o.Place != "" {
+		w.lastPlace = o.Place
+	}
+	resolved := w.level > 0
+	w.level = 0
+	contacts := w.config.Contacts
+	d.mu.Unlock()
+
+	if resolved {
+		log.Infof("WATCHDOG: %s heard again", o.Station)
+		d.Notifier.Notify(ctx, &notify.Notification{
+			Kind:      "watchdog_resolved",
+			Station:   o.Station,
+			PacketID:  o.PacketID,
+			Time:      t,
+			Text:      fmt.Sprintf("%s checked in", o.Station),
+			Callsigns: contacts,
+		})
+	}
+	if err := d.Store.UpdateWatchHeard(ctx, o.Station, t); err != nil {
+		log.Errorf("Failed to store last heard for %s: %v", o.Station, err)
+	}
+}
+
+// Check escalates any stations which are overdue.
+func (d *Watchdog) Check(ctx context.Context) {
+	for _, n := range d.overdue() {
+		d.Notifier.Notify(ctx, n)
+	}
+}
+
+// overdue advances the escalation level of overdue stations, returning the
+// notifications to send.
+func (d *Watchdog) overdue() []*notify.Notification {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var ns []*notify.Notification
+	now := d.clock().Now()
+	for station, w := range d.watches {
+		deadline := w.deadline()
+		if deadline.IsZero() || now.Before(deadline) {
+			continue
+		}
+		// Escalate once at the deadline and again after each interval.
+		level := 1 + int(now.Sub(deadline)/w.escalateAfter())
+		if level <= w.level {
+			continue
+		}
+		w.level = level
+
+		n := &notify.Notification{
+			Kind:    "watchdog_overdue",
+			Station: station,
+			Time:    now,
+			Text: fmt.Sprintf("OVERDUE %s: no check-in since %s", station,
+				w.lastHeard.Format("Jan 2 3:04 PM")),
+		}
+		if w.lastHeard.IsZero() {
+			n.Text = fmt.Sprintf("OVERDUE %s: not heard", station)
+		} else if w.lastPlace != "" {
+			n.Text += ", last " + w.lastPlace
+		}
+		if level > 1 {
+			n.Priority = notify.PriorityHigh
+			n.Callsigns = w.config.Contacts
+		}
+		log.Warnf("WATCHDOG: %s overdue since %v (level %d)", station, deadline, level)
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+func (d *Watchdog) refresh(ctx context.Context) error {
+	configs, err := d.Store.LoadWatches(ctx)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	watches := make(map[string]*watch)
+	for _, c := range configs {
+		w, ok := d.watches[c.Station]
+		if !ok {
+			w = &watch{lastHeard: c.LastHeardAt}
+		}
+		if ok && !c.ExpectedOutBy.Equal(w.config.ExpectedOutBy) {
+			// New deadline, allow alerts again.
+			w.level = 0
+		}
+		w.config = c
+		watches[c.Station] = w
+	}
+	d.watches = watches
+	return nil
+}
+
+func (d *Watchdog) Run(ctx context.Context, wg *sync.WaitGroup) {
+	d.watches = make(map[string]*watch)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r := func() {
+			err := d.refresh(ctx)
+			d.Store.SetHealth("watchdog", err)
+			if err != nil {
+				log.Errorf("Failed to refresh watchdog config: %v", err)
+			}
+		}
+		r()
+		refresh := time.NewTicker(RefreshInterval)
+		check := time.NewTicker(CheckInterval)
+		for ctx.Err() == nil {
+			select {
+			case <-refresh.C:
+				r()
+			case <-check.C:
+				d.Check(ctx)
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
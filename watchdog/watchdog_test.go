@@ -0,0 +1,179 @@
+package watchdog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"jheidel-aprs/firebase"
+	"jheidel-aprs/notify"
+	"jheidel-aprs/observe"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+type fakeStore struct {
+	watches []*firebase.Watch
+	heard   map[string]time.Time
+}
+
+func (s *fakeStore) LoadWatches(ctx context.Context) ([]*firebase.Watch, error) {
+	return s.watches, nil
+}
+
+func (s *fakeStore) UpdateWatchHeard(ctx context.Context, station string, t time.Time) error {
+	s.heard[station] = t
+	return nil
+}
+
+func (s *fakeStore) SetHealth(module string, err error) {}
+
+type recorder struct {
+	sent []*notify.Notification
+}
+
+func (r *recorder) Notify(ctx context.Context, n *notify.Notification) error {
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestTransitions(t *testing.T) {
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	type step struct {
+		// at is the offset from start of the step.
+		at time.Duration
+		// heard observes the station instead of checking deadlines.
+		heard bool
+
+		wantKind     string // empty for no notification
+		wantPriority notify.Priority
+		wantContacts bool
+	}
+	tests := []struct {
+		name  string
+		watch *firebase.Watch
+		steps []step
+	}{
+		{
+			name:  "interval",
+			watch: &firebase.Watch{IntervalMinutes: 60, EscalateAfterMinutes: 30, LastHeardAt: start},
+			steps: []step{
+				{at: 59 * time.Minute},
+				{at: 60 * time.Minute, wantKind: "watchdog_overdue"},
+				{at: 75 * time.Minute},
+				{at: 90 * time.Minute, wantKind: "watchdog_overdue", wantPriority: notify.PriorityHigh, wantContacts: true},
+				{at: 95 * time.Minute},
+				{at: 100 * time.Minute, heard: true, wantKind: "watchdog_resolved", wantContacts: true},
+				{at: 159 * time.Minute},
+				{at: 160 * time.Minute, wantKind: "watchdog_overdue"},
+			},
+		},
+		{
+			name:  "heard before deadline",
+			watch: &firebase.Watch{IntervalMinutes: 60, LastHeardAt: start},
+			steps: []step{
+				{at: 50 * time.Minute, heard: true},
+				{at: 100 * time.Minute},
+				{at: 110 * time.Minute, wantKind: "watchdog_overdue"},
+			},
+		},
+		{
+			name:  "expected out by",
+			watch: &firebase.Watch{ExpectedOutBy: start.Add(2 * time.Hour)},
+			steps: []step{
+				{at: time.Hour},
+				{at: 2 * time.Hour, wantKind: "watchdog_overdue"},
+				{at: 2*time.Hour + DefaultEscalateAfter, wantKind: "watchdog_overdue", wantPriority: notify.PriorityHigh, wantContacts: true},
+				{at: 3 * time.Hour, heard: true, wantKind: "watchdog_resolved", wantContacts: true},
+				{at: 4 * time.Hour},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tt.watch.Station = "N0CALL-9"
+			tt.watch.Contacts = []string{"K1ABC"}
+			store := &fakeStore{
+				watches: []*firebase.Watch{tt.watch},
+				heard:   make(map[string]time.Time),
+			}
+			clock := &fakeClock{now: start}
+			rec := &recorder{}
+			d := &Watchdog{
+				Store:    store,
+				Notifier: rec,
+				Clock:    clock,
+				watches:  make(map[string]*watch),
+			}
+			if err := d.refresh(ctx); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+
+			for _, s := range tt.steps {
+				clock.now = start.Add(s.at)
+				rec.sent = nil
+				if s.heard {
+					d.Observe(ctx, &observe.Observation{
+						Station: "N0CALL-9",
+						Time:    clock.now,
+					})
+					if got := store.heard["N0CALL-9"]; !got.Equal(clock.now) {
+						t.Errorf("at %v: stored last heard %v, want %v", s.at, got, clock.now)
+					}
+				} else {
+					d.Check(ctx)
+				}
+
+				if s.wantKind == "" {
+					if len(rec.sent) != 0 {
+						t.Errorf("at %v: got %s notification, want none", s.at, rec.sent[0].Kind)
+					}
+					continue
+				}
+				if len(rec.sent) != 1 {
+					t.Fatalf("at %v: got %d notifications, want one %s", s.at, len(rec.sent), s.wantKind)
+				}
+				n := rec.sent[0]
+				if n.Kind != s.wantKind {
+					t.Errorf("at %v: got %s notification, want %s", s.at, n.Kind, s.wantKind)
+				}
+				if n.Priority != s.wantPriority {
+					t.Errorf("at %v: got priority %v, want %v", s.at, n.Priority, s.wantPriority)
+				}
+				if got := len(n.Callsigns) > 0; got != s.wantContacts {
+					t.Errorf("at %v: got callsigns %v, want contacts %v", s.at, n.Callsigns, s.wantContacts)
+				}
+			}
+		})
+	}
+}
+
+func TestObserveDelayedPacket(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeStore{
+		watches: []*firebase.Watch{{Station: "N0CALL-9", IntervalMinutes: 60}},
+		heard:   make(map[string]time.Time),
+	}
+	d := &Watchdog{
+		Store:    store,
+		Notifier: &recorder{},
+		Clock:    &fakeClock{now: start.Add(time.Hour)},
+		watches:  make(map[string]*watch),
+	}
+	if err := d.refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	d.Observe(ctx, &observe.Observation{Station: "N0CALL-9", Time: start.Add(30 * time.Minute)})
+	d.Observe(ctx, &observe.Observation{Station: "N0CALL-9", Time: start.Add(10 * time.Minute)})
+	if got, want := d.watches["N0CALL-9"].lastHeard, start.Add(30*time.Minute); !got.Equal(want) {
+		t.Errorf("last heard %v, want %v", got, want)
+	}
+}